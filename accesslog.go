@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+// defaultLogTemplate renders the text access log line. It carries the same
+// fields as the json format, except that the time comes from the log prefix
+// and the client IP stands in for the remote address.
+const defaultLogTemplate = `{{.ClientIP}} {{.Method}} {{.Path}} {{.Status}} {{.Bytes}}B {{printf "%f" .DurationMs}}ms {{.RequestID}} {{printf "%q" .UserAgent}}`
+
+// accessLogEntry is one access log line: the data for the text template, or
+// the object written in json format.
+type accessLogEntry struct {
+	Time       string  `json:"time"`
+	Method     string  `json:"method"`
+	Path       string  `json:"path"`
+	Status     int     `json:"status"`
+	Bytes      int64   `json:"bytes"`
+	DurationMs float64 `json:"duration_ms"`
+	RemoteAddr string  `json:"remote_addr"`
+	ClientIP   string  `json:"client_ip"`
+	UserAgent  string  `json:"user_agent"`
+	RequestID  string  `json:"request_id,omitempty"`
+}
+
+// parseLogTemplate compiles a text access log template, checking it against
+// a sample entry so that references to unknown fields fail at startup
+// rather than on the first request.
+func parseLogTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("access-log").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(io.Discard, accessLogEntry{}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// logMiddleware logs every request to out, either as a JSON object or when
+// format is "text" rendered through tmpl. The client IP is taken from
+// X-Forwarded-For when trustProxy is set.
+func logMiddleware(format string, tmpl *template.Template, out io.Writer, trustProxy bool) func(http.Handler) http.Handler {
+	flags := log.LstdFlags
+	if format == "json" {
+		flags = 0
+	}
+	logger := log.New(out, "", flags)
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+			completed := false
+			defer func() {
+				status := rec.Status()
+				if !completed {
+					// The handler panicked; recoveryMiddleware will answer 500.
+					status = http.StatusInternalServerError
+				}
+				writeAccessLog(logger, format, tmpl, accessLogEntry{
+					Time:       start.UTC().Format(time.RFC3339Nano),
+					Method:     r.Method,
+					Path:       sanitizeLogField(r.RequestURI),
+					Status:     status,
+					Bytes:      rec.bytes,
+					DurationMs: float64(time.Since(start)) / float64(time.Millisecond),
+					RemoteAddr: r.RemoteAddr,
+					ClientIP:   sanitizeLogField(clientIP(r, trustProxy)),
+					UserAgent:  sanitizeLogField(r.UserAgent()),
+					RequestID:  requestID(r.Context()),
+				})
+			}()
+			h.ServeHTTP(rec, r)
+			completed = true
+		})
+	}
+}
+
+// sanitizeLogField escapes control and other non-printable characters in a
+// client-supplied value so that it can't break a log line in two or forge
+// one.
+func sanitizeLogField(s string) string {
+	if !strings.ContainsFunc(s, func(r rune) bool { return !unicode.IsPrint(r) }) {
+		return s
+	}
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case unicode.IsPrint(r):
+			b.WriteRune(r)
+		case r < 0x100:
+			fmt.Fprintf(&b, `\x%02x`, r)
+		default:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		}
+	}
+	return b.String()
+}
+
+func writeAccessLog(logger *log.Logger, format string, tmpl *template.Template, e accessLogEntry) {
+	if format != "json" {
+		var line strings.Builder
+		if err := tmpl.Execute(&line, e); err != nil {
+			slog.Error("access log", "err", err)
+			return
+		}
+		logger.Print(line.String())
+		return
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		slog.Error("access log", "err", err)
+		return
+	}
+	logger.Print(string(line))
+}
+
+// latencyLogEntry is the json form of a periodic latency summary.
+type latencyLogEntry struct {
+	Time     string  `json:"time"`
+	Stats    string  `json:"stats"`
+	WindowS  float64 `json:"window_s"`
+	Requests uint64  `json:"requests"`
+	P50Ms    float64 `json:"p50_ms"`
+	P90Ms    float64 `json:"p90_ms"`
+	P99Ms    float64 `json:"p99_ms"`
+}
+
+// latencyLogger returns a function that writes latency summaries to out
+// alongside the access log, in the same format.
+func latencyLogger(format string, out io.Writer) func(latencySummary) {
+	if format != "json" {
+		logger := log.New(out, "", log.LstdFlags)
+		return func(s latencySummary) {
+			logger.Printf("stats window=%s requests=%d p50=%s p90=%s p99=%s", s.Window, s.Requests, s.P50, s.P90, s.P99)
+		}
+	}
+	logger := log.New(out, "", 0)
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	return func(s latencySummary) {
+		line, err := json.Marshal(latencyLogEntry{
+			Time:     time.Now().UTC().Format(time.RFC3339Nano),
+			Stats:    "latency",
+			WindowS:  s.Window.Seconds(),
+			Requests: s.Requests,
+			P50Ms:    ms(s.P50),
+			P90Ms:    ms(s.P90),
+			P99Ms:    ms(s.P99),
+		})
+		if err != nil {
+			slog.Error("latency log", "err", err)
+			return
+		}
+		logger.Print(string(line))
+	}
+}
+
+// statusRecorder records the status code and body size written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Status returns the response status, which is 200 if the handler never
+// called WriteHeader.
+func (r *statusRecorder) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
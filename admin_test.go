@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminMux(t *testing.T) {
+	paths := []string{"/healthz", "/metrics", "/debug/pprof/"}
+	for _, admin := range []bool{false, true} {
+		cfg := testConfig(t, map[string]string{"index.html": "hi"})
+		cfg.Metrics, cfg.Pprof = true, true
+		if admin {
+			cfg.Admin = http.NewServeMux()
+		}
+		public := testHandler(t, cfg)
+
+		for _, path := range paths {
+			w := get(public, path)
+			if admin && w.Code != http.StatusNotFound {
+				t.Errorf("admin mux set: public GET %s = %d, want 404", path, w.Code)
+			}
+			if !admin && w.Code != http.StatusOK {
+				t.Errorf("no admin mux: public GET %s = %d, want 200", path, w.Code)
+			}
+			if admin {
+				w := httptest.NewRecorder()
+				cfg.Admin.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+				if w.Code != http.StatusOK {
+					t.Errorf("admin GET %s = %d, want 200", path, w.Code)
+				}
+			}
+		}
+		if w := get(public, "/"); w.Code != http.StatusOK {
+			t.Errorf("admin %v: GET / = %d, want 200", admin, w.Code)
+		}
+	}
+}
+
+func TestOpsEndpointsGuarded(t *testing.T) {
+	paths := []string{"/metrics", "/debug/pprof/", "/debug/pprof/cmdline"}
+	newCfg := func(t *testing.T) Config {
+		cfg := testConfig(t, map[string]string{"index.html": "hi"})
+		cfg.Metrics, cfg.Pprof = true, true
+		cfg.BasicAuth = "user:pass"
+		return cfg
+	}
+	withAuth := func(user, pass string) func(*http.Request) {
+		return func(r *http.Request) { r.SetBasicAuth(user, pass) }
+	}
+	send := func(h http.Handler, path string, opts ...func(*http.Request)) int {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		for _, opt := range opts {
+			opt(r)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	t.Run("basic auth on the public listener", func(t *testing.T) {
+		h := testHandler(t, newCfg(t))
+		for _, path := range append(paths, "/") {
+			if code := send(h, path); code != http.StatusUnauthorized {
+				t.Errorf("GET %s without credentials = %d, want 401", path, code)
+			}
+			if code := send(h, path, withAuth("user", "wrong")); code != http.StatusUnauthorized {
+				t.Errorf("GET %s with a wrong password = %d, want 401", path, code)
+			}
+			if code := send(h, path, withAuth("user", "pass")); code != http.StatusOK {
+				t.Errorf("GET %s with credentials = %d, want 200", path, code)
+			}
+		}
+		if code := send(h, "/healthz"); code != http.StatusOK {
+			t.Errorf("GET /healthz without credentials = %d, want 200", code)
+		}
+	})
+
+	t.Run("rate limit on the public listener", func(t *testing.T) {
+		cfg := newCfg(t)
+		cfg.BasicAuth = ""
+		cfg.RateLimit, cfg.RateBurst = 0.001, 1
+		h := testHandler(t, cfg)
+		if code := send(h, "/metrics"); code != http.StatusOK {
+			t.Fatalf("first GET /metrics = %d, want 200", code)
+		}
+		for _, path := range []string{"/metrics", "/debug/pprof/cmdline", "/"} {
+			if code := send(h, path); code != http.StatusTooManyRequests {
+				t.Errorf("GET %s over the limit = %d, want 429", path, code)
+			}
+		}
+	})
+
+	t.Run("admin listener is not guarded", func(t *testing.T) {
+		cfg := newCfg(t)
+		cfg.Admin = http.NewServeMux()
+		testHandler(t, cfg)
+		for _, path := range paths {
+			if code := send(cfg.Admin, path); code != http.StatusOK {
+				t.Errorf("admin GET %s = %d, want 200", path, code)
+			}
+		}
+	})
+}
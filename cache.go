@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// fingerprintPattern matches asset names carrying a content hash, such as
+// app.3f2a9c1b.js or main-5d41402abc4b2a76.css.
+var fingerprintPattern = regexp.MustCompile(`[.-][0-9a-fA-F]{8,}\.[^./]+$`)
+
+// cacheMiddleware sets Cache-Control on successful responses. The first of
+// rules whose pattern matches the request path decides the value; for a
+// directory that is the path of the index file from indexNames served in
+// its place, so "*.html" covers "/" too. Failing
+// that, fingerprinted assets, which never change under the same name, get
+// immutableMaxAge and the immutable directive, and everything else gets
+// maxAge; a zero maxAge sends nothing for paths no rule covers.
+// Last-Modified and If-Modified-Since are already handled by
+// http.FileServer, so revalidation of unchanged files returns 304.
+func cacheMiddleware(root http.FileSystem, indexNames []string, maxAge, immutableMaxAge time.Duration, rules cacheRules) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name := r.URL.Path
+			if strings.HasSuffix(name, "/") {
+				if file, ok := indexFile(root, name, indexNames); ok {
+					name = file
+				}
+			}
+			value, ok := rules.lookup(name)
+			switch {
+			case ok:
+			case maxAge <= 0:
+				h.ServeHTTP(w, r)
+				return
+			case fingerprintPattern.MatchString(path.Base(name)):
+				value = fmt.Sprintf("public, max-age=%d, immutable", int(immutableMaxAge.Seconds()))
+			default:
+				value = fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds()))
+			}
+			h.ServeHTTP(&cacheControlWriter{ResponseWriter: w, value: value}, r)
+		})
+	}
+}
+
+// cacheRule maps a glob to a Cache-Control value. A pattern without a
+// slash is matched against the file name, one with a slash against the
+// whole URL path. Patterns use path.Match syntax plus one level of
+// {a,b} alternation, so "*.{js,css}" covers both extensions.
+type cacheRule struct {
+	patterns []string // the pattern with braces expanded
+	raw      string
+	value    string
+}
+
+// cacheRules collects repeated -cache-rule glob=value flags, in order.
+type cacheRules []cacheRule
+
+func (c *cacheRules) String() string {
+	parts := make([]string, len(*c))
+	for i, rule := range *c {
+		parts[i] = rule.raw + "=" + rule.value
+	}
+	return strings.Join(parts, ";")
+}
+
+func (c *cacheRules) Set(value string) error {
+	// Cache-Control values contain "=", so the glob ends at the first one.
+	raw, policy, ok := strings.Cut(value, "=")
+	raw, policy = strings.TrimSpace(raw), strings.TrimSpace(policy)
+	if !ok || raw == "" || policy == "" {
+		return fmt.Errorf("want glob=cache-control, got %q", value)
+	}
+	patterns := expandBraces(raw)
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("cache rule %q: %w", raw, err)
+		}
+	}
+	*c = append(*c, cacheRule{patterns: patterns, raw: raw, value: policy})
+	return nil
+}
+
+// lookup returns the value of the first rule matching urlPath.
+func (c cacheRules) lookup(urlPath string) (string, bool) {
+	urlPath = path.Clean("/" + urlPath)
+	for _, rule := range c {
+		for _, p := range rule.patterns {
+			subject := path.Base(urlPath)
+			if strings.Contains(p, "/") {
+				subject = urlPath
+			}
+			if ok, _ := path.Match(p, subject); ok {
+				return rule.value, true
+			}
+		}
+	}
+	return "", false
+}
+
+// expandBraces expands each {a,b,...} group in pattern, without nesting.
+func expandBraces(pattern string) []string {
+	open := strings.IndexByte(pattern, '{')
+	if open < 0 {
+		return []string{pattern}
+	}
+	end := strings.IndexByte(pattern[open:], '}')
+	if end < 0 {
+		return []string{pattern}
+	}
+	end += open
+	var out []string
+	for _, alt := range strings.Split(pattern[open+1:end], ",") {
+		out = append(out, expandBraces(pattern[:open]+alt+pattern[end+1:])...)
+	}
+	return out
+}
+
+// cacheControlWriter adds a Cache-Control header when the response turns
+// out to be cacheable, so that errors such as 404s are not cached.
+type cacheControlWriter struct {
+	http.ResponseWriter
+	value       string
+	wroteHeader bool
+}
+
+func (w *cacheControlWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		switch code {
+		case http.StatusOK, http.StatusPartialContent, http.StatusNotModified:
+			if w.Header().Get("Cache-Control") == "" {
+				w.Header().Set("Cache-Control", w.value)
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *cacheControlWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExpandBraces(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"*.js", []string{"*.js"}},
+		{"*.{js,css}", []string{"*.js", "*.css"}},
+		{"/{img,fonts}/*.{png,woff2}", []string{"/img/*.png", "/img/*.woff2", "/fonts/*.png", "/fonts/*.woff2"}},
+		{"*.{js}", []string{"*.js"}},
+		{"*.{js,}", []string{"*.js", "*."}},
+		{"*.{js", []string{"*.{js"}},
+	}
+	for _, tt := range tests {
+		if got := expandBraces(tt.pattern); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("expandBraces(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestCacheRulesSet(t *testing.T) {
+	var rules cacheRules
+	for _, v := range []string{"*.html=no-cache", " /static/* = public, max-age=60 "} {
+		if err := rules.Set(v); err != nil {
+			t.Fatalf("Set(%q): %v", v, err)
+		}
+	}
+	if got, want := rules.String(), "*.html=no-cache;/static/*=public, max-age=60"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	for _, v := range []string{"", "*.html", "=no-cache", "*.html=", "[=no-cache"} {
+		if err := rules.Set(v); err == nil {
+			t.Errorf("Set(%q) succeeded, want an error", v)
+		}
+	}
+}
+
+func TestCacheRulesLookup(t *testing.T) {
+	var rules cacheRules
+	for _, v := range []string{
+		"/admin/*=no-store",
+		"*.{html,htm}=no-cache",
+		"/static/*.{js,css}=public, max-age=600",
+		"*.css=public, max-age=60",
+	} {
+		if err := rules.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		path, want string
+		ok         bool
+	}{
+		{"/index.html", "no-cache", true},
+		{"/deep/nested/page.htm", "no-cache", true},
+		{"/admin/index.html", "no-store", true},
+		{"/static/app.js", "public, max-age=600", true},
+		{"/static/site.css", "public, max-age=600", true},
+		{"/other/site.css", "public, max-age=60", true},
+		{"/static/sub/app.js", "", false},
+		{"/static/../admin/x", "no-store", true},
+		{"/resume.pdf", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := rules.lookup(tt.path)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("lookup(%q) = %q, %v, want %q, %v", tt.path, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	files := map[string]string{
+		"index.html":      "home",
+		"about.html":      "about",
+		"docs/index.html": "docs",
+		"resume.pdf":      "pdf",
+		"app.3f2a9c1b.js": "js",
+		"static/site.css": "css",
+	}
+	var rules cacheRules
+	for _, v := range []string{"*.html=no-cache", "/static/*=public, max-age=60"} {
+		if err := rules.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name   string
+		maxAge time.Duration
+		path   string
+		want   string
+	}{
+		{"rule by name", time.Hour, "/about.html", "no-cache"},
+		{"rule for directory index", time.Hour, "/", "no-cache"},
+		{"rule for nested directory index", time.Hour, "/docs/", "no-cache"},
+		{"listing uses the fallback", time.Hour, "/static/", "public, max-age=3600"},
+		{"rule by path", time.Hour, "/static/site.css", "public, max-age=60"},
+		{"fallback max-age", time.Hour, "/resume.pdf", "public, max-age=3600"},
+		{"fingerprinted", time.Hour, "/app.3f2a9c1b.js", "public, max-age=31536000, immutable"},
+		{"rule with zero max-age", 0, "/about.html", "no-cache"},
+		{"no fallback with zero max-age", 0, "/resume.pdf", ""},
+		{"errors not cached", time.Hour, "/missing.html", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t, files)
+			cfg.CacheMaxAge = tt.maxAge
+			cfg.CacheImmutableMaxAge = 365 * 24 * time.Hour
+			cfg.CacheRules = rules
+			w := get(testHandler(t, cfg), tt.path)
+			if got := w.Header().Get("Cache-Control"); got != tt.want {
+				t.Errorf("GET %s: Cache-Control = %q, want %q", tt.path, got, tt.want)
+			}
+			if tt.want != "" && w.Code != http.StatusOK {
+				t.Errorf("GET %s: status = %d, want 200", tt.path, w.Code)
+			}
+		})
+	}
+}
+
+func TestCacheRuleCustomIndex(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"home.htm": "home"})
+	cfg.Index = "index.html,home.htm"
+	if err := cfg.CacheRules.Set("*.htm=no-cache"); err != nil {
+		t.Fatal(err)
+	}
+	cfg.CacheMaxAge = time.Hour
+	w := get(testHandler(t, cfg), "/")
+	if w.Body.String() != "home" {
+		t.Fatalf("GET / = %q, want home", w.Body)
+	}
+	if got := w.Header().Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("Cache-Control = %q, want no-cache", got)
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+const (
+	// compressMinSize is the smallest response worth compressing; anything
+	// shorter is sent as-is since the framing would eat the savings.
+	compressMinSize = 1024
+	// compressMaxPDFSize is the size above which PDFs are assumed to already
+	// be compressed internally and are sent as-is.
+	compressMaxPDFSize = 1 << 20
+)
+
+// encoder is a content coding the compression middleware can produce.
+type encoder struct {
+	name      string
+	newWriter func(io.Writer) io.WriteCloser
+}
+
+// encoders lists the supported content codings in order of preference.
+// Brotli compresses text noticeably better than gzip, so it wins ties.
+var encoders = []encoder{
+	{"br", func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) }},
+	{"gzip", func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }},
+}
+
+// compressMiddleware compresses responses using the best encoding the client
+// accepts.
+func compressMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		enc, ok := findEncoder(negotiateEncoding(r.Header.Get("Accept-Encoding"), encoderNames()))
+		// A range request wants bytes of the file itself, and even if it is
+		// answered in full (a failed If-Range) the client may resume later.
+		if r.Method == http.MethodHead || r.Header.Get("Range") != "" || !ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressResponseWriter{ResponseWriter: w, enc: enc}
+		defer cw.Close()
+		h.ServeHTTP(cw, r)
+	})
+}
+
+func encoderNames() []string {
+	names := make([]string, len(encoders))
+	for i, enc := range encoders {
+		names[i] = enc.name
+	}
+	return names
+}
+
+func findEncoder(name string) (encoder, bool) {
+	for _, enc := range encoders {
+		if enc.name == name {
+			return enc, true
+		}
+	}
+	return encoder{}, false
+}
+
+// negotiateEncoding picks the content coding from supported that the
+// Accept-Encoding header value rates highest, following RFC 9110 section
+// 12.5.3: a missing q means 1, "*" covers codings not listed by name, and
+// q=0 rules a coding out. "identity" is acceptable unless excluded, and when
+// the client rates it above every supported coding it wins. Ties go to the
+// earlier entry of supported. It returns "" when the response should be sent
+// uncompressed, including when nothing at all is acceptable.
+func negotiateEncoding(acceptEncoding string, supported []string) string {
+	qs := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			k, v, _ := strings.Cut(param, "=")
+			if strings.EqualFold(strings.TrimSpace(k), "q") {
+				var err error
+				if q, err = strconv.ParseFloat(strings.TrimSpace(v), 64); err != nil || q < 0 || q > 1 {
+					q = 0
+				}
+			}
+		}
+		qs[name] = q
+	}
+	quality := func(name string) float64 {
+		if q, ok := qs[name]; ok {
+			return q
+		}
+		if q, ok := qs["*"]; ok {
+			return q
+		}
+		if name == "identity" {
+			// Always acceptable unless explicitly excluded.
+			return 0.001
+		}
+		return 0
+	}
+
+	best, bestQ := "", 0.0
+	for _, name := range supported {
+		if q := quality(name); q > bestQ {
+			best, bestQ = name, q
+		}
+	}
+	if best == "" || quality("identity") > bestQ {
+		return ""
+	}
+	return best
+}
+
+// compressResponseWriter holds back the response until it knows enough
+// about it to decide whether compressing is worthwhile: either the handler
+// declared a Content-Length, or compressMinSize bytes have been written.
+type compressResponseWriter struct {
+	http.ResponseWriter
+	enc encoder
+	cw  io.WriteCloser
+
+	status      int
+	wroteHeader bool
+	decided     bool
+	buf         []byte
+}
+
+func (w *compressResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = code
+
+	// Precompressed files arrive already encoded.
+	if code != http.StatusOK || w.Header().Get("Content-Encoding") != "" {
+		w.decide(false)
+		return
+	}
+	if cl := w.Header().Get("Content-Length"); cl != "" {
+		size, err := strconv.ParseInt(cl, 10, 64)
+		w.decide(err == nil && shouldCompress(w.Header().Get("Content-Type"), size))
+	}
+}
+
+func (w *compressResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.decided {
+		if w.cw != nil {
+			return w.cw.Write(p)
+		}
+		return w.ResponseWriter.Write(p)
+	}
+
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= compressMinSize {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(w.buf))
+		}
+		w.decide(shouldCompress(w.Header().Get("Content-Type"), int64(len(w.buf))))
+	}
+	return len(p), nil
+}
+
+// Close flushes any held-back bytes and terminates the compressed stream.
+func (w *compressResponseWriter) Close() error {
+	if !w.wroteHeader {
+		return nil
+	}
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.cw != nil {
+		return w.cw.Close()
+	}
+	return nil
+}
+
+// decide commits the response headers and flushes the buffered bytes,
+// compressed or not.
+func (w *compressResponseWriter) decide(compress bool) {
+	w.decided = true
+	if compress {
+		w.Header().Set("Content-Encoding", w.enc.name)
+		w.Header().Del("Content-Length")
+		// Byte offsets into the compressed stream don't match the file.
+		w.Header().Del("Accept-Ranges")
+		// The compressed bytes differ from the file, so a strong validator
+		// no longer applies; weak comparison still matches If-None-Match.
+		if etag := w.Header().Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			w.Header().Set("ETag", "W/"+etag)
+		}
+		w.cw = w.enc.newWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+
+	if len(w.buf) > 0 {
+		buf := w.buf
+		w.buf = nil
+		if w.cw != nil {
+			w.cw.Write(buf)
+		} else {
+			w.ResponseWriter.Write(buf)
+		}
+	}
+}
+
+// shouldCompress reports whether a response of the given type and size is
+// worth compressing.
+func shouldCompress(contentType string, size int64) bool {
+	if size < compressMinSize {
+		return false
+	}
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(strings.ToLower(mediaType))
+	switch {
+	case mediaType == "image/svg+xml":
+		return true
+	case strings.HasPrefix(mediaType, "image/"),
+		strings.HasPrefix(mediaType, "video/"),
+		strings.HasPrefix(mediaType, "audio/"):
+		return false
+	case mediaType == "application/zip", mediaType == "application/gzip":
+		return false
+	case mediaType == "application/pdf":
+		return size <= compressMaxPDFSize
+	}
+	return true
+}
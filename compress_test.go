@@ -0,0 +1,147 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestCompression(t *testing.T) {
+	big := strings.Repeat("all work and no play makes jack a dull boy\n", 100)
+	files := map[string]string{"big.txt": big, "small.txt": "tiny"}
+	tests := []struct {
+		name, accept, path string
+		wantEncoding       string
+	}{
+		{"brotli preferred", "gzip, deflate, br", "/big.txt", "br"},
+		{"gzip only", "gzip", "/big.txt", "gzip"},
+		{"brotli ruled out", "br;q=0, gzip", "/big.txt", "gzip"},
+		{"gzip rated higher", "br;q=0.5, gzip", "/big.txt", "gzip"},
+		{"nothing accepted", "", "/big.txt", ""},
+		{"too small", "br, gzip", "/small.txt", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get(testHandler(t, testConfig(t, files)), tt.path, "Accept-Encoding", tt.accept)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", w.Code)
+			}
+			if got := w.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			if !strings.Contains(w.Header().Get("Vary"), "Accept-Encoding") {
+				t.Errorf("Vary = %q, want Accept-Encoding", w.Header().Get("Vary"))
+			}
+
+			var body io.Reader = w.Body
+			switch tt.wantEncoding {
+			case "br":
+				body = brotli.NewReader(body)
+			case "gzip":
+				zr, err := gzip.NewReader(body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = zr
+			}
+			got, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := files[strings.TrimPrefix(tt.path, "/")]; string(got) != want {
+				t.Errorf("decoded body is %d bytes, want %d", len(got), len(want))
+			}
+			if tt.wantEncoding != "" {
+				if w.Header().Get("Accept-Ranges") != "" {
+					t.Error("compressed response still advertises Accept-Ranges")
+				}
+				if etag := w.Header().Get("ETag"); !strings.HasPrefix(etag, "W/") {
+					t.Errorf("ETag = %q, want a weak validator", etag)
+				}
+			}
+		})
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	supported := []string{"br", "gzip"}
+	tests := []struct {
+		accept, want string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"br", "br"},
+		{"GZIP", "gzip"},
+		{"deflate", ""},
+		{"gzip, br", "br"},
+		{"br, gzip", "br"},
+		{"gzip;q=1, br;q=1", "br"},
+		{"gzip;q=0.8, br;q=0.5", "gzip"},
+		{"gzip; q=0.8 , br ; q=0.9", "br"},
+		{"br;q=0, gzip", "gzip"},
+		{"br;q=0, gzip;q=0", ""},
+		{"*", "br"},
+		{"*;q=0.5, gzip", "gzip"},
+		{"*;q=0", ""},
+		{"br;q=0, *", "gzip"},
+		{"identity", ""},
+		{"identity;q=1, gzip;q=0.5", ""},
+		{"identity;q=0.5, gzip;q=0.5", "gzip"},
+		{"identity;q=0.1, gzip;q=0.5", "gzip"},
+		{"identity;q=0, gzip", "gzip"},
+		{"identity;q=0", ""},
+		{"*;q=0, identity;q=0", ""},
+		{"gzip;q=0.001", "gzip"},
+		{"gzip;q=0.001, identity;q=0.002", ""},
+		{"gzip;q=0.002", "gzip"},
+		{"gzip;q=bogus", ""},
+		{"gzip;q=2", ""},
+		{"gzip;q=-1, br", "br"},
+		{" , gzip", "gzip"},
+	}
+	for _, tt := range tests {
+		if got := negotiateEncoding(tt.accept, supported); got != tt.want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+	// Ties go to the earlier supported entry, whatever order the client uses.
+	if got := negotiateEncoding("br, gzip", []string{"gzip", "br"}); got != "gzip" {
+		t.Errorf("tie with gzip listed first = %q, want gzip", got)
+	}
+}
+
+func TestRangeSkipsCompression(t *testing.T) {
+	var content strings.Builder
+	for i := 0; content.Len() < 4096; i++ {
+		content.WriteString(strings.Repeat(string(rune('a'+i%26)), 10))
+	}
+	files := map[string]string{"big.txt": content.String()}
+	h := testHandler(t, testConfig(t, files))
+
+	w := get(h, "/big.txt", "Range", "bytes=0-99", "Accept-Encoding", "br, gzip")
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("status = %d, want 206", w.Code)
+	}
+	if enc := w.Header().Get("Content-Encoding"); enc != "" {
+		t.Errorf("Content-Encoding = %q, want none", enc)
+	}
+	if got := w.Header().Get("Content-Range"); got != "bytes 0-99/4100" {
+		t.Errorf("Content-Range = %q", got)
+	}
+	if got, want := w.Body.String(), content.String()[:100]; got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+
+	w = get(h, "/big.txt", "Range", "bytes=4000-", "Accept-Encoding", "gzip")
+	if w.Code != http.StatusPartialContent || w.Body.String() != content.String()[4000:] {
+		t.Errorf("suffix range = %d with %d bytes, want 206 with 100", w.Code, w.Body.Len())
+	}
+
+	if w := get(h, "/big.txt"); w.Header().Get("Accept-Ranges") != "bytes" {
+		t.Errorf("uncompressed Accept-Ranges = %q, want bytes", w.Header().Get("Accept-Ranges"))
+	}
+}
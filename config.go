@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// envPrefix starts the name of every environment variable the server reads.
+const envPrefix = "RESUME_"
+
+// flagAliases maps short flag names to the long name used in config files
+// and environment variables, so that -d on the command line also counts as
+// setting dir.
+var flagAliases = map[string]string{"d": "dir"}
+
+// envNames overrides the environment variable derived from a flag name.
+var envNames = map[string]string{"p": envPrefix + "PORT"}
+
+// explicitFlags returns the names of the flags given on the command line.
+func explicitFlags(fs *flag.FlagSet) map[string]bool {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+		if long, ok := flagAliases[f.Name]; ok {
+			set[long] = true
+		}
+	})
+	return set
+}
+
+// envName returns the environment variable for a flag: RESUME_ followed by
+// the flag name upper-cased with dashes as underscores, e.g. RESUME_CACHE_MAX_AGE.
+func envName(flagName string) string {
+	if name, ok := envNames[flagName]; ok {
+		return name
+	}
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyEnv sets every flag not in set from its environment variable, if
+// present, and adds it to set.
+func applyEnv(fs *flag.FlagSet, set map[string]bool) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || set[f.Name] {
+			return
+		}
+		if _, isAlias := flagAliases[f.Name]; isAlias {
+			return
+		}
+		v, ok := os.LookupEnv(envName(f.Name))
+		if !ok {
+			return
+		}
+		if e := setFlag(fs, f.Name, v); e != nil {
+			err = fmt.Errorf("%s: %w", envName(f.Name), e)
+			return
+		}
+		set[f.Name] = true
+	})
+	return err
+}
+
+// setFlag sets a flag from a config file or environment value. Booleans
+// also accept yes and no.
+func setFlag(fs *flag.FlagSet, name, value string) error {
+	if b, ok := fs.Lookup(name).Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+		switch strings.ToLower(value) {
+		case "yes", "y", "on":
+			value = "true"
+		case "no", "n", "off":
+			value = "false"
+		}
+	}
+	return fs.Set(name, value)
+}
+
+// applyConfigFile sets every flag named in the YAML file at path that is
+// not in set, so flags and environment variables override the file and the
+// file overrides built-in defaults. Keys are flag names without the dash;
+// a short alias such as d is read as its long name.
+func applyConfigFile(fs *flag.FlagSet, path string, set map[string]bool) error {
+	values, err := readConfigFile(path)
+	if err != nil {
+		return err
+	}
+
+	for short, long := range flagAliases {
+		v, ok := values[short]
+		if !ok {
+			continue
+		}
+		if _, both := values[long]; both {
+			return fmt.Errorf("%s: %s and %s are the same setting", path, short, long)
+		}
+		delete(values, short)
+		values[long] = v
+	}
+
+	var unknown []string
+	for key := range values {
+		if fs.Lookup(key) == nil || key == "config" {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("%s: unknown keys: %s", path, strings.Join(unknown, ", "))
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if set[key] {
+			continue
+		}
+		for _, v := range values[key] {
+			if err := setFlag(fs, key, v); err != nil {
+				return fmt.Errorf("%s: %s: %w", path, key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// readConfigFile parses the small subset of YAML the config needs: a flat
+// mapping of keys to scalars, with lists (block "- item" or inline
+// "[a, b]") for flags that may be repeated.
+func readConfigFile(path string) (map[string][]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string][]string)
+	var listKey string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := stripComment(scanner.Text())
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if item, ok := strings.CutPrefix(strings.TrimSpace(line), "- "); ok && (line[0] == ' ' || line[0] == '\t') {
+			if listKey == "" {
+				return nil, fmt.Errorf("%s:%d: list item outside a list", path, n)
+			}
+			values[listKey] = append(values[listKey], unquote(strings.TrimSpace(item)))
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			return nil, fmt.Errorf("%s:%d: unexpected indentation", path, n)
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected key: value", path, n)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if _, dup := values[key]; dup {
+			return nil, fmt.Errorf("%s:%d: duplicate key %s", path, n, key)
+		}
+
+		listKey = ""
+		switch {
+		case value == "":
+			listKey = key
+			values[key] = nil
+		case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+			values[key] = nil
+			for _, item := range strings.Split(value[1:len(value)-1], ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					values[key] = append(values[key], unquote(item))
+				}
+			}
+		default:
+			values[key] = []string{unquote(value)}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// stripComment removes a trailing # comment that isn't inside quotes.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testFlags is a cut-down version of main's flag set: a value with a short
+// alias, a plain string, a bool and a repeatable flag.
+type testFlags struct {
+	fs       *flag.FlagSet
+	dir      string
+	index    string
+	noList   bool
+	serveExt extFlags
+}
+
+func newTestFlags() *testFlags {
+	f := &testFlags{fs: flag.NewFlagSet("test", flag.ContinueOnError), serveExt: extFlags{}}
+	f.fs.SetOutput(io.Discard)
+	f.fs.StringVar(&f.dir, "d", "./docs", "")
+	f.fs.StringVar(&f.dir, "dir", "./docs", "")
+	f.fs.StringVar(&f.index, "index", "index.html", "")
+	f.fs.BoolVar(&f.noList, "no-listing", false, "")
+	f.fs.Var(&f.serveExt, "serve-ext", "")
+	f.fs.String("config", "", "")
+	return f
+}
+
+// load applies args, then the environment, then the config file (if any
+// contents are given) in the order main does.
+func (f *testFlags) load(t *testing.T, args []string, file string) error {
+	t.Helper()
+	if err := f.fs.Parse(args); err != nil {
+		return err
+	}
+	set := explicitFlags(f.fs)
+	if err := applyEnv(f.fs, set); err != nil {
+		return err
+	}
+	if file == "" {
+		return nil
+	}
+	path := filepath.Join(t.TempDir(), "server.yaml")
+	if err := os.WriteFile(path, []byte(file), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return applyConfigFile(f.fs, path, set)
+}
+
+func TestConfigFileAliases(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		file    string
+		want    string
+		wantErr string
+	}{
+		{"file d", nil, "d: from-file\n", "from-file", ""},
+		{"file dir", nil, "dir: from-file\n", "from-file", ""},
+		{"flag -dir beats file d", []string{"-dir", "from-flag"}, "d: from-file\n", "from-flag", ""},
+		{"flag -d beats file dir", []string{"-d", "from-flag"}, "dir: from-file\n", "from-flag", ""},
+		{"flag -d beats file d", []string{"-d", "from-flag"}, "d: from-file\n", "from-flag", ""},
+		{"file d and dir", nil, "d: a\ndir: b\n", "", "same setting"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newTestFlags()
+			err := f.load(t, tt.args, tt.file)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.dir != tt.want {
+				t.Errorf("dir = %q, want %q", f.dir, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name, file, wantErr string
+	}{
+		{"unknown key", "nope: 1\n", "unknown keys: nope"},
+		{"config key", "config: other.yaml\n", "unknown keys: config"},
+		{"duplicate key", "index: a\nindex: b\n", "duplicate key index"},
+		{"bad value", "no-listing: maybe\n", "no-listing"},
+		{"stray list item", "  - a\n", "list item outside a list"},
+		{"bad indentation", "index: a\n  b\n", "unexpected indentation"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newTestFlags().load(t, nil, tt.file)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		file string
+		want string
+	}{
+		{"default", nil, nil, "", "index.html"},
+		{"file over default", nil, nil, "index: file.html\n", "file.html"},
+		{"env over file", nil, map[string]string{"RESUME_INDEX": "env.html"}, "index: file.html\n", "env.html"},
+		{"env over default", nil, map[string]string{"RESUME_INDEX": "env.html"}, "", "env.html"},
+		{"flag over env", []string{"-index", "flag.html"}, map[string]string{"RESUME_INDEX": "env.html"}, "", "flag.html"},
+		{"flag over file", []string{"-index", "flag.html"}, nil, "index: file.html\n", "flag.html"},
+		{"flag over env and file", []string{"-index", "flag.html"}, map[string]string{"RESUME_INDEX": "env.html"}, "index: file.html\n", "flag.html"},
+		{"flag set to default still wins", []string{"-index", "index.html"}, map[string]string{"RESUME_INDEX": "env.html"}, "index: file.html\n", "index.html"},
+		{"empty env still counts", nil, map[string]string{"RESUME_INDEX": ""}, "index: file.html\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			f := newTestFlags()
+			if err := f.load(t, tt.args, tt.file); err != nil {
+				t.Fatal(err)
+			}
+			if f.index != tt.want {
+				t.Errorf("index = %q, want %q", f.index, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigPrecedenceAliases(t *testing.T) {
+	t.Setenv("RESUME_DIR", "from-env")
+	t.Setenv("RESUME_D", "ignored")
+	f := newTestFlags()
+	if err := f.load(t, nil, "d: from-file\n"); err != nil {
+		t.Fatal(err)
+	}
+	if f.dir != "from-env" {
+		t.Errorf("dir = %q, want from-env", f.dir)
+	}
+
+	f = newTestFlags()
+	if err := f.load(t, []string{"-d", "from-flag"}, "dir: from-file\n"); err != nil {
+		t.Fatal(err)
+	}
+	if f.dir != "from-flag" {
+		t.Errorf("dir = %q, want from-flag", f.dir)
+	}
+}
+
+func TestConfigBoolsAndLists(t *testing.T) {
+	t.Setenv("RESUME_NO_LISTING", "yes")
+	f := newTestFlags()
+	if err := f.load(t, nil, "no-listing: no\nserve-ext:\n  - .html\n  - .css\n"); err != nil {
+		t.Fatal(err)
+	}
+	if !f.noList {
+		t.Error("RESUME_NO_LISTING=yes did not override the file's no")
+	}
+	for _, ext := range []string{".html", ".css"} {
+		if !f.serveExt[ext] {
+			t.Errorf("serve-ext lacks %s: %v", ext, f.serveExt)
+		}
+	}
+}
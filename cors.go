@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// corsMiddleware adds CORS headers for requests from origin ("*" allows any
+// origin) and answers preflight requests itself.
+func corsMiddleware(origin string, maxAge time.Duration) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reqOrigin := r.Header.Get("Origin")
+			if origin != "*" {
+				w.Header().Add("Vary", "Origin")
+			}
+			if reqOrigin == "" || (origin != "*" && reqOrigin != origin) {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Range, If-None-Match, If-Modified-Since")
+			w.Header().Set("Access-Control-Expose-Headers", "Content-Length, Content-Range, ETag")
+
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				if maxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(maxAge.Seconds())))
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
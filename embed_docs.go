@@ -0,0 +1,20 @@
+//go:build embed
+
+package main
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed docs
+var embeddedDocs embed.FS
+
+// embeddedRoot returns the docs directory baked into the binary.
+func embeddedRoot() (fs.FS, bool) {
+	sub, err := fs.Sub(embeddedDocs, "docs")
+	if err != nil {
+		panic(err)
+	}
+	return sub, true
+}
@@ -0,0 +1,11 @@
+//go:build !embed
+
+package main
+
+import "io/fs"
+
+// embeddedRoot reports that no docs were embedded; build with -tags embed
+// to bake them into the binary.
+func embeddedRoot() (fs.FS, bool) {
+	return nil, false
+}
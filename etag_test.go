@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConditionalRequests(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"a.txt": "hello", "sub/b.txt": "b"})
+	h := testHandler(t, cfg)
+
+	w := get(h, "/a.txt")
+	etag, lastMod := w.Header().Get("ETag"), w.Header().Get("Last-Modified")
+	if w.Code != http.StatusOK || etag == "" || lastMod == "" {
+		t.Fatalf("GET = %d, ETag %q, Last-Modified %q", w.Code, etag, lastMod)
+	}
+	future := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	past := time.Unix(0, 0).UTC().Format(http.TimeFormat)
+
+	tests := []struct {
+		name   string
+		path   string
+		header []string
+		want   int
+	}{
+		{"If-None-Match matches", "/a.txt", []string{"If-None-Match", etag}, http.StatusNotModified},
+		{"If-None-Match weak match", "/a.txt", []string{"If-None-Match", "W/" + etag}, http.StatusNotModified},
+		{"If-None-Match star", "/a.txt", []string{"If-None-Match", "*"}, http.StatusNotModified},
+		{"If-None-Match differs", "/a.txt", []string{"If-None-Match", `"other"`}, http.StatusOK},
+		{"If-Modified-Since later", "/a.txt", []string{"If-Modified-Since", future}, http.StatusNotModified},
+		{"If-Modified-Since earlier", "/a.txt", []string{"If-Modified-Since", past}, http.StatusOK},
+		{"both, tag differs", "/a.txt", []string{"If-None-Match", `"other"`, "If-Modified-Since", future}, http.StatusOK},
+		{"both, tag matches", "/a.txt", []string{"If-None-Match", etag, "If-Modified-Since", past}, http.StatusNotModified},
+		{"listing, If-Modified-Since later", "/sub/", []string{"If-Modified-Since", future}, http.StatusNotModified},
+		{"listing, both, tag differs", "/sub/", []string{"If-None-Match", `"other"`, "If-Modified-Since", future}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get(h, tt.path, tt.header...)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if w.Code == http.StatusNotModified && w.Body.Len() != 0 {
+				t.Errorf("304 has a body: %q", w.Body)
+			}
+		})
+	}
+}
+
+func TestETagChangesWithContent(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"a.txt": "hello", "index.html": "home"})
+	h := testHandler(t, cfg)
+
+	before := get(h, "/a.txt").Header().Get("ETag")
+	if before != get(h, "/a.txt").Header().Get("ETag") {
+		t.Fatal("ETag differs between identical requests")
+	}
+	if err := os.WriteFile(filepath.Join(cfg.Dir, "a.txt"), []byte("hello, world"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	after := get(h, "/a.txt").Header().Get("ETag")
+	if after == "" || after == before {
+		t.Errorf("ETag after rewrite = %q, before %q", after, before)
+	}
+	if w := get(h, "/a.txt", "If-None-Match", before); w.Code != http.StatusOK {
+		t.Errorf("stale If-None-Match: status = %d, want 200", w.Code)
+	}
+
+	if get(h, "/").Header().Get("ETag") == "" {
+		t.Error("directory index has no ETag")
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// extFlags collects repeated -serve-ext extensions, stored lower case with a
+// leading dot.
+type extFlags map[string]bool
+
+func (e extFlags) String() string {
+	exts := make([]string, 0, len(e))
+	for ext := range e {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	return strings.Join(exts, ",")
+}
+
+func (e extFlags) Set(value string) error {
+	ext := strings.ToLower(strings.TrimSpace(value))
+	if ext == "" || ext == "." {
+		return fmt.Errorf("want a file extension such as .pdf, got %q", value)
+	}
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	e[ext] = true
+	return nil
+}
+
+// allowedExtFS hides files whose extension is not in allow, so that
+// http.FileServer answers 404 for them. Directories stay reachable, as do
+// index files, and a precompressed variant counts as the file it encodes.
+type allowedExtFS struct {
+	http.FileSystem
+	allow extFlags
+	index []string
+}
+
+func (fsys allowedExtFS) Open(name string) (http.File, error) {
+	f, err := fsys.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		return allowedExtDir{f, fsys}, nil
+	}
+	if !fsys.allowed(name) {
+		f.Close()
+		return nil, fs.ErrNotExist
+	}
+	return f, nil
+}
+
+// allowed reports whether name may be served. The name's own extension is
+// checked first, so -serve-ext .gz serves a.tar.gz; failing that, a .br or
+// .gz suffix is a precompressed variant, allowed only if its base is.
+func (fsys allowedExtFS) allowed(name string) bool {
+	if fsys.allow[strings.ToLower(path.Ext(name))] || slices.Contains(fsys.index, path.Base(name)) {
+		return true
+	}
+	for _, p := range precompressedExts {
+		if base, ok := strings.CutSuffix(name, p.ext); ok {
+			return fsys.allowed(base)
+		}
+	}
+	return false
+}
+
+// allowedExtDir leaves hidden files out of directory listings.
+type allowedExtDir struct {
+	http.File
+	fsys allowedExtFS
+}
+
+func (d allowedExtDir) Readdir(count int) ([]fs.FileInfo, error) {
+	infos, err := d.File.Readdir(count)
+	kept := infos[:0]
+	for _, info := range infos {
+		if info.IsDir() || d.fsys.allowed(info.Name()) {
+			kept = append(kept, info)
+		}
+	}
+	return kept, err
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestServeExt(t *testing.T) {
+	files := map[string]string{
+		"index.html":     "home",
+		"resume.pdf":     "pdf",
+		"a.tar.gz":       "tarball",
+		"app.js":         "js",
+		"app.js.gz":      "js-gz",
+		"secret.txt.gz":  "secret-gz",
+		".env":           "TOKEN=1",
+		"notes.txt":      "notes",
+		"sub/index.html": "sub",
+	}
+	tests := []struct {
+		name string
+		exts []string
+		path string
+		want int
+		body string
+	}{
+		{"allowed extension", []string{".pdf"}, "/resume.pdf", http.StatusOK, "pdf"},
+		{"other extension hidden", []string{".pdf"}, "/notes.txt", http.StatusNotFound, ""},
+		{"dotfile hidden", []string{".pdf", ".html"}, "/.env", http.StatusNotFound, ""},
+		{"env extension not implied", []string{".pdf"}, "/.env", http.StatusNotFound, ""},
+		{"index always served", []string{".pdf"}, "/", http.StatusOK, "home"},
+		{"nested index served", []string{".pdf"}, "/sub/", http.StatusOK, "sub"},
+		{"case-insensitive", []string{"PDF"}, "/resume.pdf", http.StatusOK, "pdf"},
+		{"gz served as its own extension", []string{".gz"}, "/a.tar.gz", http.StatusOK, "tarball"},
+		{"gz variant of allowed base", []string{".js"}, "/app.js.gz", http.StatusOK, "js-gz"},
+		{"gz variant of hidden base", []string{".js"}, "/secret.txt.gz", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t, files)
+			cfg.ServeExt = extFlags{}
+			for _, ext := range tt.exts {
+				if err := cfg.ServeExt.Set(ext); err != nil {
+					t.Fatal(err)
+				}
+			}
+			w := get(testHandler(t, cfg), tt.path)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.body != "" && w.Body.String() != tt.body {
+				t.Errorf("body = %q, want %q", w.Body, tt.body)
+			}
+		})
+	}
+}
+
+func TestServeExtListing(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"sub/a.pdf": "pdf", "sub/.env": "x", "sub/b.txt": "txt"})
+	cfg.ServeExt = extFlags{".pdf": true}
+	w := get(testHandler(t, cfg), "/sub/")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "a.pdf") {
+		t.Errorf("listing lacks a.pdf:\n%s", body)
+	}
+	for _, hidden := range []string{".env", "b.txt"} {
+		if strings.Contains(body, hidden) {
+			t.Errorf("listing shows %s:\n%s", hidden, body)
+		}
+	}
+}
@@ -0,0 +1,5 @@
+module github.com/grocky/resume
+
+go 1.22
+
+require github.com/andybalholm/brotli v1.2.5
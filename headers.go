@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// hstsMiddleware sets Strict-Transport-Security on responses sent over TLS.
+// Browsers ignore the header on plain HTTP, and sending it there would only
+// advertise a policy the connection can't back up.
+func hstsMiddleware(maxAge time.Duration, includeSubDomains bool) func(http.Handler) http.Handler {
+	value := fmt.Sprintf("max-age=%d", int(maxAge.Seconds()))
+	if includeSubDomains {
+		value += "; includeSubDomains"
+	}
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS != nil {
+				w.Header().Set("Strict-Transport-Security", value)
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// securityHeaders are the response headers set by securityMiddleware. Empty
+// fields are not sent.
+type securityHeaders struct {
+	ContentSecurityPolicy string
+	FrameOptions          string
+	ReferrerPolicy        string
+}
+
+// defaultSecurityHeaders leave out a CSP since a useful one depends on the
+// scripts and styles of the site being served.
+var defaultSecurityHeaders = securityHeaders{
+	FrameOptions:   "SAMEORIGIN",
+	ReferrerPolicy: "strict-origin-when-cross-origin",
+}
+
+// securityMiddleware adds the configured security headers to responses,
+// leaving alone any that a downstream handler has already set.
+func securityMiddleware(sh securityHeaders) func(http.Handler) http.Handler {
+	values := map[string]string{
+		"Content-Security-Policy": sh.ContentSecurityPolicy,
+		"X-Content-Type-Options":  "nosniff",
+		"X-Frame-Options":         sh.FrameOptions,
+		"Referrer-Policy":         sh.ReferrerPolicy,
+	}
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			serveWithHeaderHook(w, r, h, func(header http.Header) {
+				for k, v := range values {
+					if v != "" && header.Get(k) == "" {
+						header.Set(k, v)
+					}
+				}
+			})
+		})
+	}
+}
+
+// version identifies the build in the default Server header. Release builds
+// set it with -ldflags "-X main.version=v1.2.3".
+var version = "dev"
+
+// serverHeaderMiddleware sets the Server response header to value, which
+// downstream handlers may still replace. An empty value removes the header
+// from every response instead, whoever set it.
+func serverHeaderMiddleware(value string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if value != "" {
+				w.Header().Set("Server", value)
+				h.ServeHTTP(w, r)
+				return
+			}
+			serveWithHeaderHook(w, r, h, func(header http.Header) {
+				header.Del("Server")
+			})
+		})
+	}
+}
+
+// serveWithHeaderHook serves r with h, running hook on the response headers
+// just before they are written. A handler that writes nothing still gets an
+// implicit 200 from net/http, so the hook runs then too.
+func serveWithHeaderHook(w http.ResponseWriter, r *http.Request, h http.Handler, hook func(http.Header)) {
+	hw := &headerHookWriter{ResponseWriter: w, hook: hook}
+	h.ServeHTTP(hw, r)
+	if !hw.wroteHeader {
+		hook(w.Header())
+	}
+}
+
+// headerHookWriter runs hook on the response headers just before they are
+// written, after the wrapped handler had its chance to set them.
+type headerHookWriter struct {
+	http.ResponseWriter
+	hook        func(http.Header)
+	wroteHeader bool
+}
+
+func (w *headerHookWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.hook(w.Header())
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *headerHookWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *headerHookWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
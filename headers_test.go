@@ -0,0 +1,143 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServerHeader(t *testing.T) {
+	for _, value := range []string{"resume-server/" + version, "custom/2"} {
+		cfg := testConfig(t, map[string]string{"index.html": "hi"})
+		cfg.ServerHeader = value
+		h := testHandler(t, cfg)
+		for _, path := range []string{"/", "/missing", "/healthz"} {
+			if got := get(h, path).Header().Get("Server"); got != value {
+				t.Errorf("GET %s: Server = %q, want %q", path, got, value)
+			}
+		}
+	}
+
+	cfg := testConfig(t, map[string]string{"index.html": "hi"})
+	cfg.ServerHeader = ""
+	h := testHandler(t, cfg)
+	for _, path := range []string{"/", "/missing", "/healthz"} {
+		if got, ok := get(h, path).Header()["Server"]; ok {
+			t.Errorf("GET %s: Server = %q, want none", path, got)
+		}
+	}
+}
+
+func TestServerHeaderDownstream(t *testing.T) {
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "backend/1")
+		w.Write([]byte("ok"))
+	})
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"resume-server/dev", []string{"backend/1"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		serverHeaderMiddleware(tt.value)(backend).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if got := w.Header()["Server"]; len(got) != len(tt.want) || (len(got) > 0 && got[0] != tt.want[0]) {
+			t.Errorf("value %q: Server = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestHSTS(t *testing.T) {
+	tests := []struct {
+		name       string
+		enabled    bool
+		includeSub bool
+		target     string
+		want       string
+	}{
+		{"tls", true, false, "https://example.com/", "max-age=31536000"},
+		{"tls with subdomains", true, true, "https://example.com/", "max-age=31536000; includeSubDomains"},
+		{"plain http", true, false, "http://example.com/", ""},
+		{"disabled", false, false, "https://example.com/", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t, map[string]string{"index.html": "hi"})
+			cfg.HSTS = tt.enabled
+			cfg.HSTSMaxAge = 365 * 24 * time.Hour
+			cfg.HSTSIncludeSubDomains = tt.includeSub
+			h := testHandler(t, cfg)
+			for _, path := range []string{"", "missing"} {
+				w := get(h, tt.target+path)
+				got, ok := w.Header()["Strict-Transport-Security"]
+				if tt.want == "" {
+					if ok {
+						t.Errorf("GET %s%s: Strict-Transport-Security = %q, want none", tt.target, path, got)
+					}
+				} else if w.Header().Get("Strict-Transport-Security") != tt.want {
+					t.Errorf("GET %s%s: Strict-Transport-Security = %q, want %q", tt.target, path, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	names := []string{"Content-Security-Policy", "X-Content-Type-Options", "X-Frame-Options", "Referrer-Policy"}
+	tests := []struct {
+		name    string
+		headers securityHeaders
+		off     bool
+		want    map[string]string
+	}{
+		{"defaults", defaultSecurityHeaders, false, map[string]string{
+			"X-Content-Type-Options": "nosniff",
+			"X-Frame-Options":        "SAMEORIGIN",
+			"Referrer-Policy":        "strict-origin-when-cross-origin",
+		}},
+		{"custom", securityHeaders{ContentSecurityPolicy: "default-src 'self'", FrameOptions: "DENY"}, false, map[string]string{
+			"Content-Security-Policy": "default-src 'self'",
+			"X-Content-Type-Options":  "nosniff",
+			"X-Frame-Options":         "DENY",
+		}},
+		// Only "/" here: http.Error sends nosniff on its own.
+		{"disabled", defaultSecurityHeaders, true, map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t, map[string]string{"index.html": "hi"})
+			cfg.SecurityHeaders = tt.headers
+			cfg.NoSecurityHeaders = tt.off
+			h := testHandler(t, cfg)
+			paths := []string{"/", "/missing"}
+			if tt.off {
+				paths = paths[:1]
+			}
+			for _, path := range paths {
+				header := get(h, path).Header()
+				for _, name := range names {
+					if got := header.Get(name); got != tt.want[name] {
+						t.Errorf("GET %s: %s = %q, want %q", path, name, got, tt.want[name])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSecurityHeadersKeepDownstream(t *testing.T) {
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Frame-Options", "DENY")
+	})
+	w := httptest.NewRecorder()
+	securityMiddleware(defaultSecurityHeaders)(backend).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := w.Header().Get("X-Frame-Options"); got != "DENY" {
+		t.Errorf("X-Frame-Options = %q, want the handler's DENY", got)
+	}
+	if got := w.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Errorf("X-Content-Type-Options = %q, want nosniff", got)
+	}
+}
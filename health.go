@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync/atomic"
+)
+
+// healthHandler answers liveness/readiness probes. It reports 503 once the
+// server starts draining or when the served directory, if any, can't be read.
+type healthHandler struct {
+	dir      string
+	draining *atomic.Bool
+}
+
+func (h *healthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	status, body := http.StatusOK, map[string]string{"status": "ok"}
+	if h.draining.Load() {
+		status, body = http.StatusServiceUnavailable, map[string]string{"status": "shutting down"}
+	} else if err := h.checkDir(); err != nil {
+		status, body = http.StatusServiceUnavailable, map[string]string{"status": "unavailable", "error": err.Error()}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func (h *healthHandler) checkDir() error {
+	if h.dir == "" {
+		return nil
+	}
+	return checkDir(h.dir)
+}
+
+// drainMiddleware answers 503 to every request once draining is set, and
+// closes the connection so clients reconnect to another instance.
+func drainMiddleware(draining *atomic.Bool) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if draining.Load() {
+				w.Header().Set("Connection", "close")
+				http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// dirGuard answers 503 while dir is missing or no longer a directory, which
+// otherwise surfaces as a puzzling 404 for every file. It logs once when the
+// directory disappears and once when it comes back; serving resumes by
+// itself.
+func dirGuard(dir string) func(http.Handler) http.Handler {
+	var missing atomic.Bool
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			info, err := os.Stat(dir)
+			if err == nil && !info.IsDir() {
+				err = errors.New("not a directory")
+			}
+			if err != nil {
+				if !missing.Swap(true) {
+					slog.Error("served directory is unavailable", "dir", dir, "err", err)
+				}
+				http.Error(w, fmt.Sprintf("served directory %s is unavailable", dir), http.StatusServiceUnavailable)
+				return
+			}
+			if missing.Swap(false) {
+				slog.Info("served directory is back", "dir", dir)
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// indexMiddleware serves the first of names that exists when a directory is
+// requested. With none present the request falls through to the file
+// server, which lists the directory. http.FileServer handles index.html
+// itself, so it is passed through untouched.
+func indexMiddleware(root http.FileSystem, names []string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasSuffix(r.URL.Path, "/") {
+				h.ServeHTTP(w, r)
+				return
+			}
+			if file, ok := indexFile(root, r.URL.Path, names); ok && path.Base(file) != "index.html" {
+				r = withPath(r, file)
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// indexFile returns the path of the first of names that exists in the
+// directory dir of root.
+func indexFile(root http.FileSystem, dir string, names []string) (string, bool) {
+	dir = path.Clean("/" + dir)
+	for _, name := range names {
+		if file := path.Join(dir, name); isFile(root, file) {
+			return file, true
+		}
+	}
+	return "", false
+}
+
+// isFile reports whether name exists in root and is not a directory.
+func isFile(root http.FileSystem, name string) bool {
+	f, err := root.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	return err == nil && !info.IsDir()
+}
+
+// withPath returns a shallow copy of r with its URL path replaced.
+func withPath(r *http.Request, p string) *http.Request {
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.Path = p
+	r2.URL.RawPath = ""
+	return r2
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// prefixFlags collects repeated CIDR flags, parsing each as it is given so
+// malformed ranges are rejected at startup. A bare address is taken as a
+// single-host range.
+type prefixFlags []netip.Prefix
+
+func (p *prefixFlags) String() string {
+	parts := make([]string, len(*p))
+	for i, prefix := range *p {
+		parts[i] = prefix.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+func (p *prefixFlags) Set(value string) error {
+	prefix, err := netip.ParsePrefix(value)
+	if err != nil {
+		addr, addrErr := netip.ParseAddr(value)
+		if addrErr != nil {
+			return fmt.Errorf("invalid CIDR %q", value)
+		}
+		prefix = netip.PrefixFrom(addr, addr.BitLen())
+	}
+	*p = append(*p, prefix.Masked())
+	return nil
+}
+
+// ipFilter decides which client addresses may reach the server. Deny rules
+// win over allow rules, and an empty allowlist allows everyone not denied.
+type ipFilter struct {
+	allow, deny []netip.Prefix
+	trustProxy  bool
+}
+
+func (f *ipFilter) permits(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range f.deny {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	if len(f.allow) == 0 {
+		return true
+	}
+	for _, p := range f.allow {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *ipFilter) middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r, f.trustProxy)
+		addr, err := netip.ParseAddr(ip)
+		if err != nil || !f.permits(addr) {
+			slog.Debug("refused by IP filter", "client_ip", sanitizeLogField(ip), "request_id", requestID(r.Context()))
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func prefixes(t *testing.T, values ...string) prefixFlags {
+	t.Helper()
+	var p prefixFlags
+	for _, v := range values {
+		if err := p.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return p
+}
+
+func TestPrefixFlagsSet(t *testing.T) {
+	var p prefixFlags
+	for _, v := range []string{"10.1.2.3/8", "192.0.2.1", "2001:db8::1/32", "::1"} {
+		if err := p.Set(v); err != nil {
+			t.Fatalf("Set(%q): %v", v, err)
+		}
+	}
+	if got, want := p.String(), "10.0.0.0/8,192.0.2.1/32,2001:db8::/32,::1/128"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	for _, v := range []string{"", "10.0.0.0/33", "example.com"} {
+		if err := p.Set(v); err == nil {
+			t.Errorf("Set(%q) succeeded, want an error", v)
+		}
+	}
+}
+
+func TestIPFilter(t *testing.T) {
+	tests := []struct {
+		name        string
+		allow, deny []string
+		trustProxy  bool
+		remote      string
+		xff         string
+		want        int
+	}{
+		{"no rules", nil, nil, false, "192.0.2.1:1234", "", http.StatusOK},
+		{"ipv4 allowed", []string{"192.0.2.0/24"}, nil, false, "192.0.2.1:1234", "", http.StatusOK},
+		{"ipv4 not allowed", []string{"192.0.2.0/24"}, nil, false, "198.51.100.1:1234", "", http.StatusForbidden},
+		{"ipv4 denied", nil, []string{"203.0.113.0/24"}, false, "203.0.113.9:1234", "", http.StatusForbidden},
+		{"ipv4-mapped ipv6 denied", nil, []string{"203.0.113.0/24"}, false, "[::ffff:203.0.113.9]:1234", "", http.StatusForbidden},
+		{"ipv6 allowed", []string{"2001:db8::/32"}, nil, false, "[2001:db8::5]:1234", "", http.StatusOK},
+		{"ipv6 not allowed", []string{"2001:db8::/32"}, nil, false, "[2001:db9::5]:1234", "", http.StatusForbidden},
+		{"ipv6 denied", nil, []string{"2001:db8:bad::/48"}, false, "[2001:db8:bad::1]:1234", "", http.StatusForbidden},
+		{"deny beats allow", []string{"192.0.2.0/24"}, []string{"192.0.2.9"}, false, "192.0.2.9:1234", "", http.StatusForbidden},
+		{"xff ignored when untrusted", nil, []string{"192.0.2.0/24"}, false, "192.0.2.1:1234", "198.51.100.1", http.StatusForbidden},
+		{"xff denied", nil, []string{"203.0.113.0/24"}, true, "192.0.2.1:1234", "203.0.113.9", http.StatusForbidden},
+		{"spoofed xff cannot bypass deny", nil, []string{"203.0.113.0/24"}, true, "192.0.2.1:1234", "1.2.3.4, 203.0.113.9", http.StatusForbidden},
+		{"spoofed xff cannot satisfy allow", []string{"10.0.0.0/8"}, nil, true, "192.0.2.1:1234", "10.0.0.1, 198.51.100.1", http.StatusForbidden},
+		{"ipv6 xff allowed", []string{"2001:db8::/32"}, nil, true, "192.0.2.1:1234", "2001:db8::7", http.StatusOK},
+		{"unparsable xff refused", nil, nil, true, "192.0.2.1:1234", "unknown", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &ipFilter{allow: prefixes(t, tt.allow...), deny: prefixes(t, tt.deny...), trustProxy: tt.trustProxy}
+			h := f.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPFilterThroughServer(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"index.html": "hi"})
+	cfg.TrustProxy = true
+	cfg.DenyCIDRs = prefixes(t, "203.0.113.0/24")
+	h := testHandler(t, cfg)
+	if w := get(h, "/", "X-Forwarded-For", "1.2.3.4, 203.0.113.9"); w.Code != http.StatusForbidden {
+		t.Errorf("spoofed XFF: status = %d, want 403", w.Code)
+	}
+	if w := get(h, "/", "X-Forwarded-For", "203.0.113.9, 198.51.100.1"); w.Code != http.StatusOK {
+		t.Errorf("allowed client: status = %d, want 200", w.Code)
+	}
+}
+
+func TestIPFilterUnixSocket(t *testing.T) {
+	// Requests over a Unix socket carry no client address of their own.
+	f := &ipFilter{deny: prefixes(t, "203.0.113.0/24"), trustProxy: true}
+	h := f.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		xff  string
+		want int
+	}{
+		{"198.51.100.1", http.StatusOK},
+		{"203.0.113.9", http.StatusForbidden},
+		{"", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "@"
+		if tt.xff != "" {
+			r.Header.Set("X-Forwarded-For", tt.xff)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("X-Forwarded-For %q: status = %d, want %d", tt.xff, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// latencySlots is how many sub-windows the sliding window is split
+	// into; the oldest is dropped each time the window advances by one.
+	latencySlots = 12
+	// latencyMin and latencyGrowth define the histogram buckets: bucket i
+	// holds durations up to latencyMin * latencyGrowth^i.
+	latencyMin    = 100 * time.Microsecond
+	latencyGrowth = 1.25
+	// latencyBucketCount spans latencyMin to roughly two minutes.
+	latencyBucketCount = 64
+)
+
+// latencyStats tracks request durations over a sliding window using a
+// fixed set of exponential buckets, so memory stays constant however many
+// requests are served. Percentiles are accurate to one bucket, i.e. 25%.
+type latencyStats struct {
+	window  time.Duration
+	slotDur time.Duration
+
+	mu      sync.Mutex
+	slots   [latencySlots][latencyBucketCount]uint64
+	current int
+	started time.Time // start of the current slot
+}
+
+// latencySummary is one periodic report.
+type latencySummary struct {
+	Window   time.Duration
+	Requests uint64
+	P50      time.Duration
+	P90      time.Duration
+	P99      time.Duration
+}
+
+func newLatencyStats(window time.Duration) *latencyStats {
+	return &latencyStats{window: window, slotDur: window / latencySlots, started: time.Now()}
+}
+
+// advance rotates out slots older than the window. The caller must hold s.mu.
+func (s *latencyStats) advance(now time.Time) {
+	for n := 0; now.Sub(s.started) >= s.slotDur && n < latencySlots; n++ {
+		s.current = (s.current + 1) % latencySlots
+		s.slots[s.current] = [latencyBucketCount]uint64{}
+		s.started = s.started.Add(s.slotDur)
+	}
+	if now.Sub(s.started) >= s.slotDur {
+		// Idle for longer than the whole window; everything was cleared.
+		s.started = now
+	}
+}
+
+func (s *latencyStats) observe(d time.Duration) {
+	i := 0
+	if d > latencyMin {
+		i = int(math.Ceil(math.Log(float64(d)/float64(latencyMin)) / math.Log(latencyGrowth)))
+	}
+	i = min(i, latencyBucketCount-1)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance(time.Now())
+	s.slots[s.current][i]++
+}
+
+func (s *latencyStats) summary() latencySummary {
+	s.mu.Lock()
+	s.advance(time.Now())
+	var buckets [latencyBucketCount]uint64
+	for _, slot := range s.slots {
+		for i, n := range slot {
+			buckets[i] += n
+		}
+	}
+	s.mu.Unlock()
+
+	sum := latencySummary{Window: s.window}
+	for _, n := range buckets {
+		sum.Requests += n
+	}
+	sum.P50 = percentile(buckets, sum.Requests, 0.50)
+	sum.P90 = percentile(buckets, sum.Requests, 0.90)
+	sum.P99 = percentile(buckets, sum.Requests, 0.99)
+	return sum
+}
+
+// percentile returns the upper bound of the bucket holding the q-th
+// quantile of total observations.
+func percentile(buckets [latencyBucketCount]uint64, total uint64, q float64) time.Duration {
+	if total == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(total)))
+	var seen uint64
+	for i, n := range buckets {
+		if seen += n; seen >= rank {
+			d := time.Duration(float64(latencyMin) * math.Pow(latencyGrowth, float64(i)))
+			return d.Round(time.Microsecond)
+		}
+	}
+	return 0
+}
+
+func (s *latencyStats) middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		defer func() { s.observe(time.Since(start)) }()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// report calls emit with a summary every interval, forever.
+func (s *latencyStats) report(interval time.Duration, emit func(latencySummary)) {
+	for range time.Tick(interval) {
+		emit(s.summary())
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// concurrencyLimit lets at most max requests run at once. Requests
+// beyond that wait up to wait for a slot, then get a 503.
+func concurrencyLimit(max int, wait time.Duration) func(http.Handler) http.Handler {
+	sem := make(chan struct{}, max)
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !acquire(sem, wait, r) {
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+				return
+			}
+			// Deferred so the slot is returned even if h panics.
+			defer func() { <-sem }()
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+func acquire(sem chan struct{}, wait time.Duration, r *http.Request) bool {
+	select {
+	case sem <- struct{}{}:
+		return true
+	default:
+	}
+	if wait <= 0 {
+		return false
+	}
+
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case sem <- struct{}{}:
+		return true
+	case <-t.C:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
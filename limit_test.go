@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingHandler holds each request until release is closed, counting
+// arrivals on started.
+func blockingHandler() (h http.Handler, started chan struct{}, release chan struct{}) {
+	started, release = make(chan struct{}, 16), make(chan struct{})
+	h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	})
+	return h, started, release
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	const max = 3
+	backend, started, release := blockingHandler()
+	h := concurrencyLimit(max, 0)(backend)
+
+	codes := make(chan int, max)
+	var wg sync.WaitGroup
+	for range max {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			codes <- w.Code
+		}()
+	}
+	for range max {
+		<-started
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("request %d: status = %d, want 503", max+1, w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("503 has no Retry-After")
+	}
+
+	close(release)
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("admitted request: status = %d, want 200", code)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("after release: status = %d, want 200", w.Code)
+	}
+}
+
+func TestConcurrencyLimitWait(t *testing.T) {
+	backend, started, release := blockingHandler()
+	h := concurrencyLimit(1, time.Minute)(backend)
+
+	go h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	<-started
+
+	done := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		done <- w.Code
+	}()
+	select {
+	case code := <-done:
+		t.Fatalf("second request finished early with %d", code)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("waiting request: status = %d, want 200", code)
+	}
+}
+
+func TestConcurrencyLimitPanicReleases(t *testing.T) {
+	h := concurrencyLimit(1, 0)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/panic" {
+			panic("boom")
+		}
+	}))
+	func() {
+		defer func() { recover() }()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/panic", nil))
+	}()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("after panic: status = %d, want 200", w.Code)
+	}
+}
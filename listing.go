@@ -0,0 +1,41 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"path"
+)
+
+// noListingFS hides directories that have none of the index files, so
+// http.FileServer answers 404 instead of generating a listing of their
+// contents. Files inside such directories remain reachable by name.
+type noListingFS struct {
+	http.FileSystem
+	index []string
+}
+
+func (fsys noListingFS) Open(name string) (http.File, error) {
+	f, err := fsys.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() && !fsys.hasIndex(name) {
+		f.Close()
+		return nil, fs.ErrNotExist
+	}
+	return f, nil
+}
+
+func (fsys noListingFS) hasIndex(dir string) bool {
+	for _, name := range fsys.index {
+		if isFile(fsys.FileSystem, path.Join(dir, name)) {
+			return true
+		}
+	}
+	return false
+}
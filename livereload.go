@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// liveReloadPath is where browsers listen for reload events.
+const liveReloadPath = "/__livereload"
+
+// liveReloadScript is injected into served HTML pages in live-reload mode.
+const liveReloadScript = `<script>new EventSource("` + liveReloadPath + `").addEventListener("reload", function () { location.reload(); });</script>`
+
+// liveReload watches a directory and tells connected browsers to reload
+// over Server-Sent Events whenever something in it changes. It polls
+// rather than relying on OS notifications, which is plenty for a dev
+// server watching a handful of files.
+type liveReload struct {
+	dir      string
+	interval time.Duration
+	debounce time.Duration
+
+	mu      sync.Mutex
+	clients map[chan struct{}]struct{}
+}
+
+func newLiveReload(dir string) *liveReload {
+	return &liveReload{
+		dir:      dir,
+		interval: 500 * time.Millisecond,
+		debounce: 300 * time.Millisecond,
+		clients:  make(map[chan struct{}]struct{}),
+	}
+}
+
+// watch polls the directory forever.
+func (lr *liveReload) watch() {
+	last := lr.snapshot()
+	for range time.Tick(lr.interval) {
+		cur := lr.snapshot()
+		if equalSnapshots(last, cur) {
+			continue
+		}
+		// Editors often write a file in several steps; wait for the
+		// directory to settle so the browser reloads once.
+		for {
+			time.Sleep(lr.debounce)
+			next := lr.snapshot()
+			if equalSnapshots(cur, next) {
+				break
+			}
+			cur = next
+		}
+		last = cur
+		slog.Debug("live reload: files changed", "dir", lr.dir)
+		lr.broadcast()
+	}
+}
+
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+func (lr *liveReload) snapshot() map[string]fileStamp {
+	snap := make(map[string]fileStamp)
+	filepath.WalkDir(lr.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			snap[p] = fileStamp{info.Size(), info.ModTime()}
+		}
+		return nil
+	})
+	return snap
+}
+
+func equalSnapshots(a, b map[string]fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w.size != v.size || !w.modTime.Equal(v.modTime) {
+			return false
+		}
+	}
+	return true
+}
+
+func (lr *liveReload) broadcast() {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	for ch := range lr.clients {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// ServeHTTP streams reload events to one browser.
+func (lr *liveReload) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	ch := make(chan struct{}, 1)
+	lr.mu.Lock()
+	lr.clients[ch] = struct{}{}
+	lr.mu.Unlock()
+	defer func() {
+		lr.mu.Lock()
+		delete(lr.clients, ch)
+		lr.mu.Unlock()
+	}()
+
+	// The connection outlives any sensible write timeout; EventSource
+	// reconnects if it is dropped anyway.
+	rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		slog.Warn("live reload", "err", err)
+		return
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ch:
+			w.Write([]byte("event: reload\ndata: {}\n\n"))
+			if rc.Flush() != nil {
+				return
+			}
+		}
+	}
+}
+
+// injectMiddleware adds the live-reload script to successful HTML responses.
+func injectMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		iw := &injectWriter{ResponseWriter: w}
+		defer iw.Close()
+		h.ServeHTTP(iw, r)
+	})
+}
+
+// injectWriter buffers HTML bodies so the script can be inserted before
+// </body> and Content-Length fixed up. Anything else passes straight through.
+type injectWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	inject      bool
+	buf         bytes.Buffer
+}
+
+func (w *injectWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = code
+	w.inject = code == http.StatusOK &&
+		strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") &&
+		w.Header().Get("Content-Encoding") == ""
+	if !w.inject {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *injectWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.inject {
+		return w.buf.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *injectWriter) Close() {
+	if !w.inject {
+		return
+	}
+	body := w.buf.Bytes()
+	if i := bytes.LastIndex(bytes.ToLower(body), []byte("</body>")); i >= 0 {
+		body = append(body[:i:i], append([]byte(liveReloadScript), body[i:]...)...)
+	} else {
+		body = append(body, liveReloadScript...)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(body)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// maintenanceRetryAfter is what clients are told to wait during maintenance.
+const maintenanceRetryAfter = 5 * time.Minute
+
+// maintenanceMiddleware answers 503 with the contents of page for as long as
+// that file exists, so maintenance is switched on by creating it and off by
+// removing it, without restarting the server.
+func maintenanceMiddleware(page string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := os.ReadFile(page)
+			if err != nil {
+				h.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Cache-Control", "no-store")
+			w.Header().Set("Retry-After", strconv.Itoa(int(maintenanceRetryAfter.Seconds())))
+			w.WriteHeader(http.StatusServiceUnavailable)
+			if r.Method != http.MethodHead {
+				w.Write(body)
+			}
+		})
+	}
+}
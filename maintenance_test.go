@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMaintenance(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"index.html": "home"})
+	cfg.Maintenance = filepath.Join(t.TempDir(), "maintenance.html")
+	h := testHandler(t, cfg)
+
+	if w := get(h, "/"); w.Code != http.StatusOK || w.Body.String() != "home" {
+		t.Fatalf("before: GET / = %d %q, want 200 home", w.Code, w.Body)
+	}
+
+	if err := os.WriteFile(cfg.Maintenance, []byte("<h1>back soon</h1>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/", "/index.html", "/missing"} {
+		w := get(h, path)
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("during: GET %s = %d, want 503", path, w.Code)
+		}
+		if w.Body.String() != "<h1>back soon</h1>" {
+			t.Errorf("during: GET %s body = %q, want the maintenance page", path, w.Body)
+		}
+		if got := w.Header().Get("Retry-After"); got != "300" {
+			t.Errorf("during: Retry-After = %q, want 300", got)
+		}
+		if got := w.Header().Get("Cache-Control"); got != "no-store" {
+			t.Errorf("during: Cache-Control = %q, want no-store", got)
+		}
+	}
+	r := httptest.NewRequest(http.MethodHead, "/", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusServiceUnavailable || w.Body.Len() != 0 {
+		t.Errorf("during: HEAD / = %d with %d bytes, want 503 without a body", w.Code, w.Body.Len())
+	}
+	if w := get(h, "/healthz"); w.Code != http.StatusOK {
+		t.Errorf("during: GET /healthz = %d, want 200", w.Code)
+	}
+
+	if err := os.Remove(cfg.Maintenance); err != nil {
+		t.Fatal(err)
+	}
+	if w := get(h, "/"); w.Code != http.StatusOK || w.Body.String() != "home" {
+		t.Errorf("after: GET / = %d %q, want 200 home", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the request duration
+// histogram. They match the Prometheus client's default buckets.
+var latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metrics collects request counts and latencies and renders them in the
+// Prometheus text exposition format. It is deliberately small: the server
+// only needs a counter and a histogram, not a full client library.
+type metrics struct {
+	mu       sync.Mutex
+	requests map[requestKey]uint64
+	buckets  []uint64
+	count    uint64
+	sum      float64
+}
+
+type requestKey struct {
+	method string
+	status int
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests: make(map[requestKey]uint64),
+		buckets:  make([]uint64, len(latencyBuckets)),
+	}
+}
+
+func (m *metrics) observe(method string, status int, d time.Duration) {
+	seconds := d.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[requestKey{metricMethod(method), status}]++
+	for i, le := range latencyBuckets {
+		if seconds <= le {
+			m.buckets[i]++
+		}
+	}
+	m.count++
+	m.sum += seconds
+}
+
+// middleware records every request passing through h.
+func (m *metrics) middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		h.ServeHTTP(rec, r)
+		m.observe(r.Method, rec.Status(), time.Since(start))
+	})
+}
+
+// ServeHTTP writes the collected metrics. It is mounted outside
+// m.middleware so scrapes don't count themselves.
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	keys := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].status < keys[j].status
+	})
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	fmt.Fprintln(w, "# HELP http_requests_total Total HTTP requests served, by method and status.")
+	fmt.Fprintln(w, "# TYPE http_requests_total counter")
+	for _, k := range keys {
+		fmt.Fprintf(w, "http_requests_total{method=%q,status=\"%d\"} %d\n", k.method, k.status, m.requests[k])
+	}
+
+	fmt.Fprintln(w, "# HELP http_request_duration_seconds HTTP request latency.")
+	fmt.Fprintln(w, "# TYPE http_request_duration_seconds histogram")
+	for i, le := range latencyBuckets {
+		fmt.Fprintf(w, "http_request_duration_seconds_bucket{le=%q} %d\n", strconv.FormatFloat(le, 'g', -1, 64), m.buckets[i])
+	}
+	fmt.Fprintf(w, "http_request_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.count)
+	fmt.Fprintf(w, "http_request_duration_seconds_sum %g\n", m.sum)
+	fmt.Fprintf(w, "http_request_duration_seconds_count %d\n", m.count)
+	m.mu.Unlock()
+}
+
+// metricMethod folds non-standard methods into one label value so clients
+// can't blow up the number of series.
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "OTHER"
+}
@@ -0,0 +1,60 @@
+package main
+
+import "net/http"
+
+// middleware wraps a handler with extra behaviour.
+type middleware = func(http.Handler) http.Handler
+
+// chain composes middlewares into one, with the first listed outermost: it
+// sees the request first and the response last. Nil entries are skipped,
+// which keeps optional middleware readable at the call site via when.
+//
+// The server orders its middleware as follows, outermost first:
+//
+//   - recovery, so a panic anywhere below still gets a 500 response;
+//   - request ID, so everything after it can log the ID;
+//   - access logging and metrics, so they see the final status of every
+//     request including rejections below them (health checks excepted
+//     unless -log-healthz is set);
+//   - traversal checks, connection limits and IP filtering, to turn
+//     traffic away cheaply;
+//   - HSTS and security headers;
+//   - drain, maintenance, rate limiting, CORS then auth, CORS ahead of
+//     auth because preflight requests carry no credentials;
+//   - caching and compression, then the file handlers.
+func chain(mws ...middleware) middleware {
+	return func(h http.Handler) http.Handler {
+		for i := len(mws) - 1; i >= 0; i-- {
+			if mws[i] != nil {
+				h = mws[i](h)
+			}
+		}
+		return h
+	}
+}
+
+// when returns mw if cond holds and nil, which chain skips, otherwise.
+func when(cond bool, mw middleware) middleware {
+	if !cond {
+		return nil
+	}
+	return mw
+}
+
+// unlessPath returns mw applied to every request except those for exactly
+// p, which go straight to the wrapped handler. A nil mw stays nil.
+func unlessPath(p string, mw middleware) middleware {
+	if mw == nil {
+		return nil
+	}
+	return func(h http.Handler) http.Handler {
+		wrapped := mw(h)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == p {
+				h.ServeHTTP(w, r)
+				return
+			}
+			wrapped.ServeHTTP(w, r)
+		})
+	}
+}
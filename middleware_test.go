@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// syncBuffer is a bytes.Buffer safe for the access log to write from one
+// goroutine while the test reads from another.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// tracer returns a middleware that records name in *log on the way in and
+// "/"+name on the way out.
+func tracer(log *[]string, name string) middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*log = append(*log, name)
+			h.ServeHTTP(w, r)
+			*log = append(*log, "/"+name)
+		})
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	var log []string
+	h := chain(
+		tracer(&log, "a"),
+		nil,
+		when(false, tracer(&log, "skipped")),
+		tracer(&log, "b"),
+		when(true, tracer(&log, "c")),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log = append(log, "handler")
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	want := []string{"a", "b", "c", "handler", "/c", "/b", "/a"}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("order = %v, want %v", log, want)
+	}
+}
+
+func TestChainEmpty(t *testing.T) {
+	called := false
+	chain()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if !called {
+		t.Error("empty chain did not call the handler")
+	}
+}
+
+// TestServerMiddlewareOrder checks the orderings the server relies on, as
+// documented on chain.
+func TestServerMiddlewareOrder(t *testing.T) {
+	t.Run("access log sees rate limiting", func(t *testing.T) {
+		var out bytes.Buffer
+		cfg := testConfig(t, map[string]string{"index.html": "hi"})
+		cfg.AccessLog = &out
+		cfg.RateLimit, cfg.RateBurst = 0.001, 1
+		h := testHandler(t, cfg)
+		get(h, "/")
+		if w := get(h, "/"); w.Code != http.StatusTooManyRequests {
+			t.Fatalf("second request = %d, want 429", w.Code)
+		}
+		if !strings.Contains(out.String(), "GET / 429") {
+			t.Errorf("access log lacks the 429:\n%s", out.String())
+		}
+	})
+
+	t.Run("access log and metrics see early rejections", func(t *testing.T) {
+		var out bytes.Buffer
+		cfg := testConfig(t, map[string]string{"index.html": "hi"})
+		cfg.AccessLog = &out
+		cfg.Metrics = true
+		cfg.DenyCIDRs = prefixes(t, "198.51.100.0/24")
+		h := testHandler(t, cfg)
+
+		if w := get(h, "/%252e%252e/etc/passwd"); w.Code != http.StatusBadRequest {
+			t.Fatalf("traversal = %d, want 400", w.Code)
+		}
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "198.51.100.7:1234"
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("denied client = %d, want 403", w.Code)
+		}
+		for _, want := range []string{"GET /%252e%252e/etc/passwd 400", "GET / 403"} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("access log lacks %q:\n%s", want, out.String())
+			}
+		}
+
+		body := get(h, "/metrics").Body.String()
+		for _, want := range []string{`status="400"`, `status="403"`} {
+			if !strings.Contains(body, want) {
+				t.Errorf("metrics lack %s:\n%s", want, body)
+			}
+		}
+	})
+
+	t.Run("access log sees the connection limit", func(t *testing.T) {
+		backend, started, release := blockingHandler()
+		slow := httptest.NewServer(backend)
+		defer slow.Close()
+		defer close(release)
+
+		var out syncBuffer
+		cfg := testConfig(t, map[string]string{"index.html": "hi"})
+		cfg.AccessLog = &out
+		cfg.MaxConns = 1
+		if err := cfg.Proxies.Set("/slow=" + slow.URL); err != nil {
+			t.Fatal(err)
+		}
+		h := testHandler(t, cfg)
+		go get(h, "/slow/")
+		<-started
+
+		if w := get(h, "/"); w.Code != http.StatusServiceUnavailable {
+			t.Fatalf("second request = %d, want 503", w.Code)
+		}
+		if !strings.Contains(out.String(), "GET / 503") {
+			t.Errorf("access log lacks the 503:\n%s", out.String())
+		}
+	})
+
+	t.Run("healthz logged only with -log-healthz", func(t *testing.T) {
+		for _, logHealthz := range []bool{false, true} {
+			var out bytes.Buffer
+			cfg := testConfig(t, map[string]string{"index.html": "hi"})
+			cfg.AccessLog = &out
+			cfg.LogHealthz = logHealthz
+			get(testHandler(t, cfg), "/healthz")
+			if logged := strings.Contains(out.String(), "GET /healthz 200"); logged != logHealthz {
+				t.Errorf("-log-healthz %v: healthz logged = %v:\n%s", logHealthz, logged, out.String())
+			}
+		}
+	})
+
+	t.Run("CORS preflight ahead of auth", func(t *testing.T) {
+		cfg := testConfig(t, map[string]string{"index.html": "hi"})
+		cfg.CORSOrigin = "https://example.com"
+		cfg.BasicAuth = "user:pass"
+		h := testHandler(t, cfg)
+
+		r := httptest.NewRequest(http.MethodOptions, "/", nil)
+		r.Header.Set("Origin", "https://example.com")
+		r.Header.Set("Access-Control-Request-Method", "GET")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code == http.StatusUnauthorized {
+			t.Fatal("preflight was challenged for credentials")
+		}
+		if w.Header().Get("Access-Control-Allow-Origin") != "https://example.com" {
+			t.Errorf("Access-Control-Allow-Origin = %q", w.Header().Get("Access-Control-Allow-Origin"))
+		}
+		if w := get(h, "/"); w.Code != http.StatusUnauthorized {
+			t.Errorf("GET without credentials = %d, want 401", w.Code)
+		}
+	})
+
+	t.Run("request ID on rejections", func(t *testing.T) {
+		cfg := testConfig(t, map[string]string{"index.html": "hi"})
+		cfg.DenyCIDRs = prefixes(t, "192.0.2.0/24")
+		w := get(testHandler(t, cfg), "/")
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("status = %d, want 403", w.Code)
+		}
+		if w.Header().Get("X-Request-ID") == "" {
+			t.Error("IP filter rejection has no X-Request-ID")
+		}
+	})
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// mimeFlags collects repeated -mime ext=type overrides.
+type mimeFlags map[string]string
+
+func (m mimeFlags) String() string {
+	parts := make([]string, 0, len(m))
+	for ext, typ := range m {
+		parts = append(parts, ext+"="+typ)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (m mimeFlags) Set(value string) error {
+	ext, typ, ok := strings.Cut(value, "=")
+	if !ok || ext == "" || typ == "" {
+		return fmt.Errorf("want ext=type, got %q", value)
+	}
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	m[ext] = typ
+	return nil
+}
+
+// register installs the overrides in the mime package, which http.FileServer
+// consults when picking a Content-Type.
+func (m mimeFlags) register() error {
+	for ext, typ := range m {
+		if err := mime.AddExtensionType(ext, typ); err != nil {
+			return fmt.Errorf("-mime %s=%s: %w", ext, typ, err)
+		}
+	}
+	return nil
+}
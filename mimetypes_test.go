@@ -0,0 +1,61 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"testing"
+)
+
+// setMimeTypes registers values as -mime flags would, restoring the previous
+// types afterwards since the mime package's table is process-wide.
+func setMimeTypes(t *testing.T, values ...string) {
+	t.Helper()
+	m := mimeFlags{}
+	for _, v := range values {
+		if err := m.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for ext := range m {
+		if old := mime.TypeByExtension(ext); old != "" {
+			t.Cleanup(func() { mime.AddExtensionType(ext, old) })
+		}
+	}
+	if err := m.register(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMimeOverride(t *testing.T) {
+	setMimeTypes(t, "md=text/markdown", ".resumetest=application/x-resume-test")
+	h := testHandler(t, testConfig(t, map[string]string{"r.md": "# Resume", "a.resumetest": "x"}))
+
+	tests := []struct{ path, want string }{
+		{"/r.md", "text/markdown; charset=utf-8"},
+		{"/a.resumetest", "application/x-resume-test"},
+	}
+	for _, tt := range tests {
+		w := get(h, tt.path)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d, want 200", tt.path, w.Code)
+		}
+		if got := w.Header().Get("Content-Type"); got != tt.want {
+			t.Errorf("GET %s: Content-Type = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestMimeFlagsSet(t *testing.T) {
+	m := mimeFlags{}
+	for _, v := range []string{"md", "=text/plain", "md=", ""} {
+		if err := m.Set(v); err == nil {
+			t.Errorf("Set(%q) succeeded, want an error", v)
+		}
+	}
+	if err := m.Set("md=text/markdown"); err != nil || m[".md"] != "text/markdown" {
+		t.Errorf("Set(md=text/markdown) = %v, map %v", err, m)
+	}
+	if err := (mimeFlags{".x": "not a type"}).register(); err == nil {
+		t.Error("register accepted an invalid media type")
+	}
+}
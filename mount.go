@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// mount maps a URL prefix to a directory served beneath it.
+type mount struct {
+	prefix string // always begins and ends with "/"
+	dir    string
+}
+
+// mountFlags collects repeated -mount prefix=dir flags.
+type mountFlags []mount
+
+func (m *mountFlags) String() string {
+	parts := make([]string, len(*m))
+	for i, mt := range *m {
+		parts[i] = mt.prefix + "=" + mt.dir
+	}
+	return strings.Join(parts, ",")
+}
+
+func (m *mountFlags) Set(value string) error {
+	prefix, dir, ok := strings.Cut(value, "=")
+	if !ok || prefix == "" || dir == "" {
+		return fmt.Errorf("want prefix=dir, got %q", value)
+	}
+	prefix = path.Clean("/" + prefix)
+	if prefix == "/" {
+		return fmt.Errorf("mount %q: use -dir to set what is served at /", value)
+	}
+	*m = append(*m, mount{prefix: prefix + "/", dir: dir})
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMounts(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"index.html": "home"})
+	other := testConfig(t, map[string]string{"a.txt": "mounted"})
+	if err := cfg.Mounts.Set("files=" + other.Dir); err != nil {
+		t.Fatal(err)
+	}
+	h := testHandler(t, cfg)
+	if w := get(h, "/files/a.txt"); w.Code != http.StatusOK || w.Body.String() != "mounted" {
+		t.Errorf("GET /files/a.txt = %d %q, want 200 mounted", w.Code, w.Body)
+	}
+	if w := get(h, "/"); w.Body.String() != "home" {
+		t.Errorf("GET / = %q, want home", w.Body)
+	}
+}
+
+func TestRoutePrefixConflicts(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name            string
+		mounts, proxies []string
+		wantErr         string
+	}{
+		{"distinct", []string{"/a=" + dir, "/b=" + dir}, []string{"/c=http://127.0.0.1:1"}, ""},
+		{"same mount twice", []string{"/a=" + dir, "/a/=" + dir}, nil, "/a/ is mounted more than once"},
+		{"mount and proxy", []string{"/a=" + dir}, []string{"a=http://127.0.0.1:1"}, "/a/ is both mounted and proxied"},
+		{"same proxy twice", nil, []string{"/p=http://127.0.0.1:1", "/p/=http://127.0.0.1:2"}, "/p/ is proxied more than once"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t, map[string]string{"index.html": "home"})
+			for _, v := range tt.mounts {
+				if err := cfg.Mounts.Set(v); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, v := range tt.proxies {
+				if err := cfg.Proxies.Set(v); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, err := newServer(cfg)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("newServer: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("newServer error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// notFoundMiddleware replaces the body of any 404 response with page.
+func notFoundMiddleware(page []byte) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.ServeHTTP(&notFoundWriter{ResponseWriter: w, page: page}, r)
+		})
+	}
+}
+
+// notFoundWriter passes everything through except 404 responses, whose
+// headers and body it swaps for the custom page.
+type notFoundWriter struct {
+	http.ResponseWriter
+	page        []byte
+	wroteHeader bool
+	swallow     bool
+}
+
+func (w *notFoundWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if code == http.StatusNotFound {
+		w.swallow = true
+		h := w.Header()
+		h.Del("X-Content-Type-Options")
+		h.Set("Content-Type", "text/html; charset=utf-8")
+		h.Set("Content-Length", strconv.Itoa(len(w.page)))
+		w.ResponseWriter.WriteHeader(code)
+		w.ResponseWriter.Write(w.page)
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *notFoundWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.swallow {
+		return len(p), nil
+	}
+	return w.ResponseWriter.Write(p)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// precompressedExts maps content codings to the file suffix of their
+// precompressed variants, in order of preference, matching encoders.
+var precompressedExts = []struct{ encoding, ext string }{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// precompressedMiddleware serves foo.js.br or foo.js.gz in place of foo.js
+// when the sibling exists and the client accepts that encoding. Otherwise
+// the request falls through to h.
+func precompressedMiddleware(root http.FileSystem) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name := path.Clean("/" + r.URL.Path)
+			if strings.HasSuffix(r.URL.Path, "/") || !isFile(root, name) {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Accept-Encoding")
+			var available []string
+			for _, p := range precompressedExts {
+				if isFile(root, name+p.ext) {
+					available = append(available, p.encoding)
+				}
+			}
+			if encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), available); encoding != "" {
+				if servePrecompressed(w, r, root, name, encoding) {
+					return
+				}
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// servePrecompressed serves the variant of name for encoding, reporting
+// false if it could not be opened.
+func servePrecompressed(w http.ResponseWriter, r *http.Request, root http.FileSystem, name, encoding string) bool {
+	var ext string
+	for _, p := range precompressedExts {
+		if p.encoding == encoding {
+			ext = p.ext
+		}
+	}
+	f, err := root.Open(name + ext)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		return false
+	}
+
+	ctype := mime.TypeByExtension(path.Ext(name))
+	if ctype == "" {
+		ctype = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", ctype)
+	w.Header().Set("Content-Encoding", encoding)
+	http.ServeContent(w, r, name, info.ModTime(), f)
+	return true
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// proxyRoute forwards requests under a URL prefix to a backend.
+type proxyRoute struct {
+	prefix string // always begins and ends with "/"
+	target *url.URL
+}
+
+// proxyFlags collects repeated -proxy prefix=URL flags.
+type proxyFlags []proxyRoute
+
+func (p *proxyFlags) String() string {
+	parts := make([]string, len(*p))
+	for i, pr := range *p {
+		parts[i] = pr.prefix + "=" + pr.target.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+func (p *proxyFlags) Set(value string) error {
+	prefix, rawURL, ok := strings.Cut(value, "=")
+	if !ok || prefix == "" || rawURL == "" {
+		return fmt.Errorf("want prefix=URL, got %q", value)
+	}
+	prefix = path.Clean("/" + prefix)
+	if prefix == "/" {
+		return fmt.Errorf("proxy %q: can't proxy /, the served directory lives there", value)
+	}
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("proxy %q: %w", value, err)
+	}
+	if (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("proxy %q: target must be an absolute http or https URL", value)
+	}
+	*p = append(*p, proxyRoute{prefix: prefix + "/", target: target})
+	return nil
+}
+
+// handler returns a reverse proxy for the route, to be mounted behind
+// http.StripPrefix. It sets the X-Forwarded-For, -Host, -Proto and -Prefix
+// headers, keeping an incoming X-Forwarded-For chain only when trustProxy
+// is set, and answers 502 when the backend can't be reached.
+func (pr proxyRoute) handler(trustProxy bool) http.Handler {
+	prefix := strings.TrimSuffix(pr.prefix, "/")
+	return &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			if trustProxy {
+				r.Out.Header["X-Forwarded-For"] = r.In.Header["X-Forwarded-For"]
+			}
+			r.SetURL(pr.target)
+			r.SetXForwarded()
+			r.Out.Header.Set("X-Forwarded-Prefix", prefix)
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			slog.Error("proxy", "prefix", prefix, "target", pr.target.String(), "path", r.URL.Path, "request_id", requestID(r.Context()), "err", err)
+			http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		},
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		remote     string
+		xff        []string
+		trustProxy bool
+		want       string
+	}{
+		{"remote addr", "192.0.2.7:5555", nil, false, "192.0.2.7"},
+		{"ipv6 remote addr", "[2001:db8::1]:5555", nil, false, "2001:db8::1"},
+		{"no port", "192.0.2.7", nil, false, "192.0.2.7"},
+		{"xff ignored when untrusted", "192.0.2.7:5555", []string{"198.51.100.1"}, false, "192.0.2.7"},
+		{"single xff entry", "192.0.2.7:5555", []string{"198.51.100.1"}, true, "198.51.100.1"},
+		{"rightmost entry wins", "192.0.2.7:5555", []string{"1.2.3.4, 203.0.113.9"}, true, "203.0.113.9"},
+		{"rightmost across header lines", "192.0.2.7:5555", []string{"1.2.3.4", "203.0.113.9"}, true, "203.0.113.9"},
+		{"ipv6 xff", "192.0.2.7:5555", []string{"2001:db8::2"}, true, "2001:db8::2"},
+		{"empty xff falls back", "192.0.2.7:5555", []string{""}, true, "192.0.2.7"},
+		{"trailing comma falls back", "192.0.2.7:5555", []string{"1.2.3.4,"}, true, "192.0.2.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := clientIP(r, tt.trustProxy); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimiterUsesRightmostXFF(t *testing.T) {
+	h := newRateLimiter(1, 1, true).middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	send := func(xff string) int {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Forwarded-For", xff)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	if code := send("10.0.0.1, 198.51.100.1"); code != http.StatusOK {
+		t.Fatalf("first request = %d, want 200", code)
+	}
+	// A fresh spoofed left-hand entry must not buy a new bucket.
+	if code := send("10.0.0.2, 198.51.100.1"); code != http.StatusTooManyRequests {
+		t.Errorf("second request = %d, want 429", code)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+)
+
+// recoveryMiddleware turns a panic anywhere below it into a logged stack
+// trace and a 500 response. It should wrap everything else.
+func recoveryMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				// Deliberate abort; let net/http drop the connection quietly.
+				panic(v)
+			}
+			// The request ID middleware runs inside this one, so the ID is
+			// only available from the response header it set.
+			slog.Error("panic", "method", r.Method, "path", r.RequestURI,
+				"request_id", w.Header().Get("X-Request-ID"), "panic", v, "stack", string(debug.Stack()))
+			if rec.status == 0 {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+		}()
+		h.ServeHTTP(rec, r)
+	})
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"net"
+	"net/http"
+)
+
+// httpsRedirect permanently redirects every request to the same path and
+// query on https, at tlsPort unless that is the default 443.
+func httpsRedirect(tlsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if tlsPort != "443" {
+			host = net.JoinHostPort(host, tlsPort)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
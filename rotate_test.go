@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	f, err := openRotatingFile(path, 25, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for i := range 7 {
+		if _, err := fmt.Fprintf(f, "line %d\n", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Each 7-byte line fits three to a 25-byte file.
+	for name, want := range map[string]string{
+		path:        "line 6\n",
+		path + ".1": "line 3\nline 4\nline 5\n",
+		path + ".2": "line 0\nline 1\nline 2\n",
+	} {
+		if got := readFile(t, name); got != want {
+			t.Errorf("%s = %q, want %q", filepath.Base(name), got, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("%s.3 exists beyond -log-max-backups", filepath.Base(path))
+	}
+}
+
+func TestRotatingFileNoBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	f, err := openRotatingFile(path, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.Write([]byte("first\n"))
+	f.Write([]byte("second\n"))
+	if got := readFile(t, path); got != "second\n" {
+		t.Errorf("log = %q, want only the second line", got)
+	}
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Error("a backup was kept with -log-max-backups 0")
+	}
+}
+
+func TestRotatingFileMovedAway(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	f, err := openRotatingFile(path, 25, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("before move\n"))
+	// logrotate got there first.
+	if err := os.Rename(path, filepath.Join(dir, "moved.log")); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"after move\n", "and again\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatalf("Write after the file was moved: %v", err)
+		}
+	}
+	// Until the file fills up the writes follow the open file; the rotation
+	// then finds nothing to rename and starts a new one.
+	if got := readFile(t, filepath.Join(dir, "moved.log")); got != "before move\nafter move\n" {
+		t.Errorf("moved log = %q", got)
+	}
+	if got := readFile(t, path); got != "and again\n" {
+		t.Errorf("log = %q, want the line written after the rotation", got)
+	}
+}
+
+func TestRotatingFileRenameFails(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	f, err := openRotatingFile(path, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// A directory in the way of the backup makes the rename fail.
+	if err := os.MkdirAll(filepath.Join(path+".1", "x"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	f.Write([]byte("first\n"))
+	if _, err := f.Write([]byte("second\n")); err != nil {
+		t.Fatalf("Write after a failed rotation: %v", err)
+	}
+	if got := readFile(t, path); got != "first\nsecond\n" {
+		t.Errorf("log = %q, want both lines kept in place", got)
+	}
+}
+
+func TestRotatingFileConcurrent(t *testing.T) {
+	const writers, lines = 8, 200
+	path := filepath.Join(t.TempDir(), "access.log")
+	f, err := openRotatingFile(path, 1<<10, writers*lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range lines {
+				if _, err := fmt.Fprintf(f, "writer %d line %03d\n", w, i); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := filepath.Glob(path + "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) < 2 {
+		t.Fatalf("got %d files, want the log to have rotated", len(names))
+	}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > 1<<10 {
+			t.Errorf("%s is %d bytes, over the limit", filepath.Base(name), info.Size())
+		}
+		for _, line := range strings.Split(strings.TrimSuffix(readFile(t, name), "\n"), "\n") {
+			var w, i int
+			if _, err := fmt.Sscanf(line, "writer %d line %d", &w, &i); err != nil {
+				t.Fatalf("%s: garbled line %q", filepath.Base(name), line)
+			}
+			seen[line] = true
+		}
+	}
+	if len(seen) != writers*lines {
+		t.Errorf("found %d distinct lines, want %d", len(seen), writers*lines)
+	}
+}
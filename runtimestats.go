@@ -0,0 +1,41 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// runtimeStats counts requests so that a diagnostics dump can report them
+// alongside the Go runtime's own figures.
+type runtimeStats struct {
+	start    time.Time
+	requests atomic.Uint64
+}
+
+func newRuntimeStats() *runtimeStats {
+	return &runtimeStats{start: time.Now()}
+}
+
+func (s *runtimeStats) middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// dump logs goroutine count, memory use, uptime and requests served.
+func (s *runtimeStats) dump() {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	slog.Info("runtime stats",
+		"goroutines", runtime.NumGoroutine(),
+		"heap_alloc_bytes", m.HeapAlloc,
+		"heap_objects", m.HeapObjects,
+		"sys_bytes", m.Sys,
+		"gc_cycles", m.NumGC,
+		"uptime", time.Since(s.start).Round(time.Second).String(),
+		"requests", s.requests.Load())
+}
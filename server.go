@@ -1,29 +1,646 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
-	"log"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
-func logMiddleware(h http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		h.ServeHTTP(w, r)
-		duration := float64(time.Since(start)) / float64(time.Millisecond)
-		log.Printf("%s %s %fms", r.Method, r.RequestURI, duration)
-	})
+// checkDir reports whether dir exists, is a directory and can be read.
+func checkDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("cannot serve %s: %w", dir, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("cannot serve %s: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("cannot serve %s: not a directory", dir)
+	}
+	if _, err := f.Readdirnames(1); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("cannot serve %s: %w", dir, err)
+	}
+	return nil
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage of %s:\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintf(out, `
+Every flag can also be set with an environment variable named %s plus the
+flag name in upper case with dashes as underscores (RESUME_CACHE_MAX_AGE for
+-cache-max-age); -p is %s. Booleans accept true/false, 1/0 and yes/no.
+Precedence is command line, then environment, then -config file, then the
+defaults above.
+
+On Unix, send SIGUSR1 to log goroutine, memory and request counts.
+`, envPrefix, envName("p"))
+}
+
+// Config holds everything newServer needs to build the handler chain. The
+// zero value is not useful; main fills it from flags, tests from literals.
+type Config struct {
+	Dir      string // directory to serve
+	Embedded fs.FS  // if set, served instead of Dir
+	Mounts   mountFlags
+	Proxies  proxyFlags
+	Index    string // comma-separated index file names
+	NotFound string // HTML file for 404 bodies
+	// Maintenance is an HTML page; while it exists, every request for files
+	// or proxied routes gets it with a 503.
+	Maintenance string
+
+	ServeExt       extFlags // if non-empty, the only file extensions served
+	NoListing      bool
+	FollowSymlinks bool // follow symlinks that lead outside the directory
+	ETag           bool
+	SPA            bool
+	Precompressed  bool
+	LiveReload     bool
+
+	CacheMaxAge          time.Duration
+	CacheImmutableMaxAge time.Duration
+	CacheRules           cacheRules
+
+	LogFormat     string
+	LogTemplate   string
+	AccessLog     io.Writer // defaults to stderr
+	StatsInterval time.Duration
+	StatsWindow   time.Duration
+
+	// AccessLogFile and Listen are opened by main rather than newServer;
+	// they are here so validate can check them before anything starts.
+	AccessLogFile string
+	Listen        string // host:port or unix:/path/to.sock
+
+	Healthz    bool
+	LogHealthz bool
+	Metrics    bool
+	Pprof      bool
+
+	BasicAuth  string // user:pass
+	CORSOrigin string
+	CORSMaxAge time.Duration
+	RateLimit  float64
+	RateBurst  int
+	TrustProxy bool
+	AllowCIDRs prefixFlags
+	DenyCIDRs  prefixFlags
+
+	MaxConns     int
+	MaxConnsWait time.Duration
+
+	HSTS                  bool
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubDomains bool
+	NoSecurityHeaders     bool
+	SecurityHeaders       securityHeaders
+	ServerHeader          string // empty suppresses the Server header
+
+	Timeouts serverTimeouts
+
+	// Admin, if set, receives /healthz, /metrics and /debug/pprof/ in place
+	// of the public mux. Otherwise /metrics and /debug/pprof/ get the same
+	// rate limit and basic auth as the files.
+	Admin *http.ServeMux
+
+	// Stats, if set, counts every request for runtime diagnostics.
+	Stats *runtimeStats
+
+	// Draining is set by the caller when shutdown begins; /healthz then
+	// reports 503. If nil, newServer allocates one nobody sets.
+	Draining       *atomic.Bool
+	DrainRejectAll bool
+}
+
+// validate reports every problem with cfg, without starting anything.
+func (cfg Config) validate() []error {
+	var errs []error
+	if cfg.LogFormat != "text" && cfg.LogFormat != "json" {
+		errs = append(errs, fmt.Errorf("unknown -log-format %q: want text or json", cfg.LogFormat))
+	}
+	if _, err := parseLogTemplate(cfg.LogTemplate); err != nil {
+		errs = append(errs, fmt.Errorf("bad -log-template: %w", err))
+	}
+	if cfg.BasicAuth != "" {
+		if user, _, ok := strings.Cut(cfg.BasicAuth, ":"); !ok || user == "" {
+			errs = append(errs, errors.New("-basic-auth must be in the form user:pass"))
+		}
+	}
+
+	if cfg.Embedded == nil {
+		if err := checkDir(cfg.Dir); err != nil {
+			errs = append(errs, err)
+		}
+	} else if cfg.LiveReload {
+		errs = append(errs, errors.New("-live-reload needs an on-disk directory, not embedded docs"))
+	}
+	// Two routes on one prefix would make ServeMux panic at startup.
+	prefixes := make(map[string]string)
+	for _, mt := range cfg.Mounts {
+		if err := checkDir(mt.dir); err != nil {
+			errs = append(errs, err)
+		}
+		if prefixes[mt.prefix] != "" {
+			errs = append(errs, fmt.Errorf("%s is mounted more than once", mt.prefix))
+		}
+		prefixes[mt.prefix] = "mounted"
+	}
+	for _, pr := range cfg.Proxies {
+		switch prefixes[pr.prefix] {
+		case "mounted":
+			errs = append(errs, fmt.Errorf("%s is both mounted and proxied", pr.prefix))
+		case "proxied":
+			errs = append(errs, fmt.Errorf("%s is proxied more than once", pr.prefix))
+		}
+		prefixes[pr.prefix] = "proxied"
+	}
+	if cfg.NotFound != "" {
+		if _, err := os.ReadFile(cfg.NotFound); err != nil {
+			errs = append(errs, fmt.Errorf("cannot read 404 page: %w", err))
+		}
+	}
+	if cfg.AccessLogFile != "" {
+		if err := checkLogFile(cfg.AccessLogFile); err != nil {
+			errs = append(errs, fmt.Errorf("cannot write -access-log: %w", err))
+		}
+	}
+	if path, ok := strings.CutPrefix(cfg.Listen, unixPrefix); ok {
+		if err := checkSocketPath(path); err != nil {
+			errs = append(errs, fmt.Errorf("cannot listen on %s: %w", cfg.Listen, err))
+		}
+		// Connections on a socket have no client IP, so the filter would
+		// refuse every request.
+		if !cfg.TrustProxy && len(cfg.AllowCIDRs)+len(cfg.DenyCIDRs) > 0 {
+			errs = append(errs, errors.New("-allow-cidr and -deny-cidr need -trust-proxy on a unix: listener"))
+		}
+	}
+
+	if cfg.RateLimit < 0 {
+		errs = append(errs, errors.New("-rate-limit must not be negative"))
+	}
+	if cfg.RateLimit > 0 && cfg.RateBurst < 1 {
+		errs = append(errs, errors.New("-rate-burst must be at least 1"))
+	}
+	if cfg.MaxConns < 0 {
+		errs = append(errs, errors.New("-max-connections must not be negative"))
+	}
+	if cfg.StatsInterval > 0 && cfg.StatsWindow < cfg.StatsInterval {
+		errs = append(errs, errors.New("-log-stats-window must be at least -log-stats-interval"))
+	}
+	for _, d := range []struct {
+		flag  string
+		value time.Duration
+	}{
+		{"cache-max-age", cfg.CacheMaxAge},
+		{"cache-immutable-max-age", cfg.CacheImmutableMaxAge},
+		{"cors-max-age", cfg.CORSMaxAge},
+		{"hsts-max-age", cfg.HSTSMaxAge},
+		{"max-connections-wait", cfg.MaxConnsWait},
+		{"log-stats-interval", cfg.StatsInterval},
+		{"read-header-timeout", cfg.Timeouts.ReadHeader},
+		{"read-timeout", cfg.Timeouts.Read},
+		{"write-timeout", cfg.Timeouts.Write},
+		{"idle-timeout", cfg.Timeouts.Idle},
+	} {
+		if d.value < 0 {
+			errs = append(errs, fmt.Errorf("-%s must not be negative", d.flag))
+		}
+	}
+	return errs
+}
+
+// newServer validates cfg and returns a server with the full handler chain
+// and timeouts applied, ready to Serve on a listener. Background work the
+// configuration asks for, such as live reload polling, starts immediately.
+func newServer(cfg Config) (*http.Server, error) {
+	if errs := cfg.validate(); len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	accessLogTemplate, err := parseLogTemplate(cfg.LogTemplate)
+	if err != nil {
+		return nil, err
+	}
+	authUser, authPass, _ := strings.Cut(cfg.BasicAuth, ":")
+	if cfg.Embedded == nil {
+		if names, err := os.ReadDir(cfg.Dir); err == nil && len(names) == 0 {
+			slog.Warn("served directory is empty; run make build or check -dir", "dir", cfg.Dir)
+		}
+	}
+
+	var notFoundPage []byte
+	if cfg.NotFound != "" {
+		if notFoundPage, err = os.ReadFile(cfg.NotFound); err != nil {
+			return nil, fmt.Errorf("cannot read 404 page: %w", err)
+		}
+	}
+
+	var indexNames []string
+	for _, name := range strings.Split(cfg.Index, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			indexNames = append(indexNames, name)
+		}
+	}
+
+	accessLogOut := cfg.AccessLog
+	if accessLogOut == nil {
+		accessLogOut = os.Stderr
+	}
+	accessLog := logMiddleware(cfg.LogFormat, accessLogTemplate, accessLogOut, cfg.TrustProxy)
+	if cfg.StatsInterval > 0 {
+		stats := newLatencyStats(cfg.StatsWindow)
+		go stats.report(cfg.StatsInterval, latencyLogger(cfg.LogFormat, accessLogOut))
+		accessLog = chain(stats.middleware, accessLog)
+	}
+
+	// serveFiles builds the handler for one served directory.
+	serveFiles := func(root http.FileSystem) http.Handler {
+		if len(cfg.ServeExt) > 0 {
+			root = allowedExtFS{root, cfg.ServeExt, indexNames}
+		}
+		if cfg.NoListing {
+			root = noListingFS{root, indexNames}
+		}
+		return chain(
+			when(cfg.CacheMaxAge > 0 || len(cfg.CacheRules) > 0, cacheMiddleware(root, indexNames, cfg.CacheMaxAge, cfg.CacheImmutableMaxAge, cfg.CacheRules)),
+			compressMiddleware,
+			when(cfg.LiveReload, injectMiddleware),
+			when(cfg.Precompressed, precompressedMiddleware(root)),
+			when(cfg.SPA, spaMiddleware(root)),
+			when(notFoundPage != nil, notFoundMiddleware(notFoundPage)),
+			when(cfg.Index != "index.html", indexMiddleware(root, indexNames)),
+			when(cfg.ETag, etagMiddleware(root)),
+			precedenceMiddleware,
+		)(http.FileServer(root))
+	}
+
+	dirFS := func(dir string) http.FileSystem {
+		if cfg.FollowSymlinks {
+			return http.Dir(dir)
+		}
+		return confinedDir(dir)
+	}
+	files := http.NewServeMux()
+	if cfg.Embedded != nil {
+		files.Handle("/", serveFiles(http.FS(cfg.Embedded)))
+	} else {
+		files.Handle("/", dirGuard(cfg.Dir)(serveFiles(dirFS(cfg.Dir))))
+	}
+	for _, mt := range cfg.Mounts {
+		files.Handle(mt.prefix, http.StripPrefix(strings.TrimSuffix(mt.prefix, "/"), dirGuard(mt.dir)(serveFiles(dirFS(mt.dir)))))
+	}
+	for _, pr := range cfg.Proxies {
+		files.Handle(pr.prefix, http.StripPrefix(strings.TrimSuffix(pr.prefix, "/"), pr.handler(cfg.TrustProxy)))
+	}
+
+	draining := cfg.Draining
+	if draining == nil {
+		draining = new(atomic.Bool)
+	}
+	rateLimit := when(cfg.RateLimit > 0, newRateLimiter(cfg.RateLimit, cfg.RateBurst, cfg.TrustProxy).middleware)
+	basicAuth := when(cfg.BasicAuth != "", basicAuthMiddleware(authUser, authPass))
+
+	mux := http.NewServeMux()
+	ops := mux
+	// guardOps protects /metrics and /debug/pprof/ like the files when they
+	// share the public listener; pprof's cmdline alone would give away the
+	// -basic-auth credentials. /healthz stays open for load balancers.
+	guardOps := chain(rateLimit, basicAuth)
+	if cfg.Admin != nil {
+		ops = cfg.Admin
+		guardOps = chain()
+	}
+	if cfg.Healthz {
+		hh := &healthHandler{draining: draining}
+		if cfg.Embedded == nil {
+			hh.dir = cfg.Dir
+		}
+		var health http.Handler = hh
+		if cfg.LogHealthz && cfg.Admin != nil {
+			health = accessLog(health)
+		}
+		ops.Handle("/healthz", health)
+	}
+	if cfg.LiveReload {
+		lr := newLiveReload(cfg.Dir)
+		go lr.watch()
+		mux.Handle(liveReloadPath, lr)
+	}
+	if cfg.Pprof {
+		profiles := http.NewServeMux()
+		registerPprof(profiles)
+		ops.Handle("/debug/pprof/", guardOps(profiles))
+	}
+	var recordMetrics middleware
+	if cfg.Metrics {
+		m := newMetrics()
+		recordMetrics = m.middleware
+		ops.Handle("/metrics", guardOps(m))
+	}
+	mux.Handle("/", chain(
+		when(cfg.DrainRejectAll, drainMiddleware(draining)),
+		when(cfg.Maintenance != "", maintenanceMiddleware(cfg.Maintenance)),
+		rateLimit,
+		// CORS goes outside auth: browsers send preflights without credentials.
+		when(cfg.CORSOrigin != "", corsMiddleware(cfg.CORSOrigin, cfg.CORSMaxAge)),
+		basicAuth,
+	)(files))
+
+	// The access log and metrics sit outside every middleware that can turn
+	// a request away, so rejections are recorded too.
+	observe := chain(accessLog, recordMetrics)
+	if cfg.Healthz && !cfg.LogHealthz && cfg.Admin == nil {
+		observe = unlessPath("/healthz", observe)
+	}
+	filter := &ipFilter{allow: cfg.AllowCIDRs, deny: cfg.DenyCIDRs, trustProxy: cfg.TrustProxy}
+	top := chain(
+		recoveryMiddleware,
+		when(cfg.Stats != nil, cfg.Stats.middleware),
+		serverHeaderMiddleware(cfg.ServerHeader),
+		requestIDMiddleware,
+		observe,
+		traversalMiddleware,
+		when(cfg.MaxConns > 0, concurrencyLimit(cfg.MaxConns, cfg.MaxConnsWait)),
+		when(len(cfg.AllowCIDRs) > 0 || len(cfg.DenyCIDRs) > 0, filter.middleware),
+		when(cfg.HSTS, hstsMiddleware(cfg.HSTSMaxAge, cfg.HSTSIncludeSubDomains)),
+		when(!cfg.NoSecurityHeaders, securityMiddleware(cfg.SecurityHeaders)),
+	)(mux)
+
+	srv := &http.Server{Handler: top}
+	cfg.Timeouts.apply(srv)
+	return srv, nil
 }
 
 func main() {
-	port := flag.String("p", "9000", "port to serve on")
-	directory := "./docs"
+	cfg := Config{Timeouts: defaultTimeouts, SecurityHeaders: defaultSecurityHeaders, ServeExt: extFlags{}}
+	port := flag.String("p", "", "port to serve on (default 9000, or 9443 with TLS)")
+	flag.StringVar(&cfg.Listen, "listen", "", "address to listen on, host:port or unix:/path/to.sock; overrides -p")
+	certFile := flag.String("cert", "", "TLS certificate file; requires -key")
+	keyFile := flag.String("key", "", "TLS private key file; requires -cert")
+	drainDelay := flag.Duration("drain-delay", 0, "on shutdown, keep serving this long with /healthz reporting 503 so load balancers stop routing here first")
+	flag.BoolVar(&cfg.DrainRejectAll, "drain-reject-all", false, "during -drain-delay, answer every request with 503 rather than only /healthz")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 10*time.Second, "time allowed for in-flight requests to finish on shutdown")
+	flag.DurationVar(&cfg.CacheMaxAge, "cache-max-age", 0, "Cache-Control max-age for served files; 0 sends no Cache-Control")
+	flag.DurationVar(&cfg.CacheImmutableMaxAge, "cache-immutable-max-age", 365*24*time.Hour, "Cache-Control max-age for fingerprinted assets when -cache-max-age is set")
+	flag.Var(&cfg.CacheRules, "cache-rule", "Cache-Control for paths matching a glob, as glob=value (e.g. '*.html=no-cache'); the first matching rule wins over -cache-max-age; may be repeated")
+	flag.BoolVar(&cfg.ETag, "etag", true, "send content-hash ETags and honor If-None-Match")
+	flag.BoolVar(&cfg.SPA, "spa", false, "serve index.html for missing extensionless paths (single-page apps)")
+	flag.StringVar(&cfg.NotFound, "not-found", "", "HTML file to serve as the body of 404 responses")
+	flag.StringVar(&cfg.Maintenance, "maintenance-file", "", "while this HTML file exists, answer every request except /healthz with it and a 503; create or remove it to toggle maintenance")
+	flag.StringVar(&cfg.LogFormat, "log-format", "text", "format of the access log and server messages: text or json")
+	logLevel := flag.String("log-level", "info", "least severe server message to log: debug, info, warn or error")
+	flag.StringVar(&cfg.LogTemplate, "log-template", defaultLogTemplate, "text/template for text access log lines; fields: .Time .Method .Path .Status .Bytes .DurationMs .RemoteAddr .ClientIP .UserAgent .RequestID")
+	flag.BoolVar(&cfg.Metrics, "metrics", false, "expose Prometheus metrics at /metrics")
+	flag.StringVar(&cfg.BasicAuth, "basic-auth", "", "require HTTP Basic credentials user:pass for served files, and for /metrics and /debug/pprof/ unless -admin-addr is set")
+	flag.BoolVar(&cfg.Healthz, "healthz", true, "serve a health check at /healthz")
+	flag.BoolVar(&cfg.LogHealthz, "log-healthz", false, "include /healthz requests in the access log")
+	flag.StringVar(&cfg.CORSOrigin, "cors-origin", "", "allowed CORS origin, or * for any; empty disables CORS headers")
+	flag.DurationVar(&cfg.CORSMaxAge, "cors-max-age", 10*time.Minute, "how long browsers may cache CORS preflight results")
+	flag.Float64Var(&cfg.RateLimit, "rate-limit", 0, "requests per second allowed per client IP; 0 disables rate limiting")
+	flag.IntVar(&cfg.RateBurst, "rate-burst", 20, "requests a client may make in a burst above -rate-limit")
+	flag.BoolVar(&cfg.TrustProxy, "trust-proxy", false, "take the client IP from the rightmost X-Forwarded-For entry for rate limiting, IP filtering and access logs")
+	adminAddr := flag.String("admin-addr", "", "serve /healthz, /metrics and /debug/pprof/ on this address (e.g. 127.0.0.1:9090) instead of the public listener")
+	redirectHTTP := flag.String("redirect-http", "", "with TLS, also listen on this address (e.g. :80) and redirect plain HTTP to HTTPS")
+	flag.StringVar(&cfg.Index, "index", "index.html", "comma-separated list of index files to try for directory requests")
+	flag.Var(cfg.ServeExt, "serve-ext", "only serve files with this extension, such as .pdf; may be repeated; unset serves every file")
+	flag.BoolVar(&cfg.NoListing, "no-listing", false, "answer 404 instead of listing directories without an index file")
+	flag.BoolVar(&cfg.FollowSymlinks, "follow-symlinks", false, "serve files through symlinks that point outside the served directory; otherwise they get a 403")
+	flag.StringVar(&cfg.AccessLogFile, "access-log", "", "write access logs to this file instead of stderr; SIGHUP reopens it")
+	logMaxSize := flag.Int64("log-max-size", 100, "rotate the -access-log file after this many megabytes; 0 disables rotation")
+	logMaxBackups := flag.Int("log-max-backups", 5, "number of rotated -access-log files to keep")
+	flag.BoolVar(&cfg.HSTS, "hsts", false, "send Strict-Transport-Security on TLS responses")
+	flag.DurationVar(&cfg.HSTSMaxAge, "hsts-max-age", 365*24*time.Hour, "max-age for -hsts")
+	flag.BoolVar(&cfg.HSTSIncludeSubDomains, "hsts-include-subdomains", false, "add includeSubDomains to -hsts")
+	flag.BoolVar(&cfg.NoSecurityHeaders, "no-security-headers", false, "don't send X-Content-Type-Options, X-Frame-Options, Referrer-Policy or CSP")
+	flag.StringVar(&cfg.SecurityHeaders.ContentSecurityPolicy, "csp", "", "Content-Security-Policy to send; empty sends none")
+	flag.StringVar(&cfg.SecurityHeaders.FrameOptions, "frame-options", defaultSecurityHeaders.FrameOptions, "X-Frame-Options to send")
+	flag.StringVar(&cfg.SecurityHeaders.ReferrerPolicy, "referrer-policy", defaultSecurityHeaders.ReferrerPolicy, "Referrer-Policy to send")
+	flag.StringVar(&cfg.ServerHeader, "server-header", "resume-server/"+version, "value of the Server response header")
+	noServerHeader := flag.Bool("no-server-header", false, "send no Server header, overriding -server-header")
+	flag.DurationVar(&cfg.Timeouts.ReadHeader, "read-header-timeout", defaultTimeouts.ReadHeader, "time allowed to read request headers")
+	flag.DurationVar(&cfg.Timeouts.Read, "read-timeout", defaultTimeouts.Read, "time allowed to read a whole request")
+	flag.DurationVar(&cfg.Timeouts.Write, "write-timeout", defaultTimeouts.Write, "time allowed to write a whole response; must cover the slowest download of the largest file")
+	flag.DurationVar(&cfg.Timeouts.Idle, "idle-timeout", defaultTimeouts.Idle, "how long an idle keep-alive connection is kept open")
+	keepAlive := flag.Bool("keep-alive", true, "reuse connections for further requests; false closes each after one response")
+	flag.IntVar(&cfg.MaxConns, "max-connections", 0, "maximum requests handled at once; 0 means unlimited")
+	flag.DurationVar(&cfg.MaxConnsWait, "max-connections-wait", 0, "how long a request over -max-connections waits for a slot before getting a 503")
+	flag.Var(&cfg.Mounts, "mount", "also serve a directory under a URL prefix, as prefix=dir; may be repeated")
+	flag.Var(&cfg.Proxies, "proxy", "forward requests under a URL prefix to a backend, as prefix=URL with the prefix stripped; may be repeated")
+	flag.BoolVar(&cfg.LiveReload, "live-reload", false, "dev mode: reload open pages in the browser when served files change")
+	flag.Var(&cfg.AllowCIDRs, "allow-cidr", "only allow clients in this CIDR range; may be repeated; needs -trust-proxy with a unix: -listen")
+	flag.Var(&cfg.DenyCIDRs, "deny-cidr", "refuse clients in this CIDR range, even if allowed; may be repeated")
+	mimeTypes := mimeFlags{}
+	flag.Var(mimeTypes, "mime", "Content-Type override for a file extension, as ext=type; may be repeated")
+	flag.BoolVar(&cfg.Precompressed, "precompressed", false, "serve foo.br or foo.gz in place of foo when present and accepted")
+	configPath := flag.String("config", "", "YAML file of flag values; command-line flags and environment variables take precedence")
+	checkConfig := flag.Bool("check-config", false, "validate flags, environment and -config, report any problems and exit without serving")
+	flag.BoolVar(&cfg.Pprof, "pprof", false, "expose net/http/pprof profiles under /debug/pprof/; they reveal internals, so don't enable on a public listener")
+	flag.DurationVar(&cfg.StatsInterval, "log-stats-interval", 0, "log request count and p50/p90/p99 latency this often; 0 disables")
+	flag.DurationVar(&cfg.StatsWindow, "log-stats-window", 5*time.Minute, "sliding window the -log-stats-interval figures cover")
+	flag.StringVar(&cfg.Dir, "d", "./docs", "directory to serve")
+	flag.StringVar(&cfg.Dir, "dir", "./docs", "directory to serve (same as -d)")
+	flag.Usage = usage
 	flag.Parse()
 
-	fs := http.FileServer(http.Dir(directory))
-	http.Handle("/", logMiddleware(fs))
+	// Collect every problem before giving up, so that one run (or
+	// -check-config) lists them all.
+	var problems []error
+	set := explicitFlags(flag.CommandLine)
+	if err := applyEnv(flag.CommandLine, set); err != nil {
+		problems = append(problems, err)
+	}
+	if *configPath != "" {
+		if err := applyConfigFile(flag.CommandLine, *configPath, set); err != nil {
+			problems = append(problems, err)
+		}
+	}
+
+	if err := setupLogging(*logLevel, cfg.LogFormat); err != nil {
+		problems = append(problems, err)
+	}
+
+	if *noServerHeader {
+		cfg.ServerHeader = ""
+	}
+	cfg.Timeouts.NoKeepAlive = !*keepAlive
+
+	if err := mimeTypes.register(); err != nil {
+		problems = append(problems, err)
+	}
+
+	directory := cfg.Dir
+	if embedded, ok := embeddedRoot(); ok {
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "d" || f.Name == "dir" {
+				slog.Warn("ignoring flag: serving the embedded docs", "flag", f.Name)
+			}
+		})
+		cfg.Embedded = embedded
+		directory = "embedded docs"
+	}
+
+	useTLS := *certFile != "" || *keyFile != ""
+	if useTLS && (*certFile == "" || *keyFile == "") {
+		problems = append(problems, errors.New("both -cert and -key must be provided to serve over TLS"))
+	} else if useTLS {
+		if _, err := tls.LoadX509KeyPair(*certFile, *keyFile); err != nil {
+			problems = append(problems, fmt.Errorf("cannot load TLS key pair: %w", err))
+		}
+	}
+
+	if *redirectHTTP != "" && !useTLS {
+		problems = append(problems, errors.New("-redirect-http requires -cert and -key"))
+	}
+	if *logMaxSize < 0 || *logMaxBackups < 0 {
+		problems = append(problems, errors.New("-log-max-size and -log-max-backups must not be negative"))
+	}
+
+	problems = append(problems, cfg.validate()...)
+	for _, err := range problems {
+		slog.Error(err.Error())
+	}
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+	if *checkConfig {
+		slog.Info("configuration ok")
+		return
+	}
+
+	if *port == "" {
+		*port = "9000"
+		if useTLS {
+			*port = "9443"
+		}
+	}
+
+	if cfg.AccessLogFile != "" {
+		f, err := openRotatingFile(cfg.AccessLogFile, *logMaxSize<<20, *logMaxBackups)
+		if err != nil {
+			fatal("cannot open access log", "err", err)
+		}
+		defer f.Close()
+		cfg.AccessLog = f
+
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				if err := f.Reopen(); err != nil {
+					slog.Error("reopen access log", "err", err)
+				}
+			}
+		}()
+	}
+
+	var draining atomic.Bool
+	cfg.Draining = &draining
+	cfg.Stats = newRuntimeStats()
+	onDumpSignal(cfg.Stats.dump)
+	if *adminAddr != "" {
+		cfg.Admin = http.NewServeMux()
+	}
+	srv, err := newServer(cfg)
+	if err != nil {
+		fatal(err.Error())
+	}
+
+	addr := ":" + *port
+	if cfg.Listen != "" {
+		addr = cfg.Listen
+		if _, p, err := net.SplitHostPort(addr); err == nil {
+			*port = p
+		}
+	}
+	ln, err := listen(addr)
+	if err != nil {
+		fatal("cannot listen", "addr", addr, "err", err)
+	}
+
+	servers := []*http.Server{srv}
+	if useTLS {
+		serve(func() error {
+			return srv.ServeTLS(ln, *certFile, *keyFile)
+		}, "serving over HTTPS", "dir", directory, "addr", addr)
+	} else {
+		serve(func() error {
+			return srv.Serve(ln)
+		}, "serving over HTTP", "dir", directory, "addr", addr)
+	}
+	if *redirectHTTP != "" {
+		redirect := &http.Server{Addr: *redirectHTTP, Handler: httpsRedirect(*port)}
+		cfg.Timeouts.apply(redirect)
+		servers = append(servers, redirect)
+		serve(redirect.ListenAndServe, "redirecting HTTP to HTTPS", "addr", *redirectHTTP)
+	}
+	if cfg.Admin != nil {
+		admin := &http.Server{Addr: *adminAddr, Handler: recoveryMiddleware(cfg.Admin)}
+		cfg.Timeouts.apply(admin)
+		servers = append(servers, admin)
+		serve(admin.ListenAndServe, "serving admin endpoints", "addr", *adminAddr)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+
+	draining.Store(true)
+	if *drainDelay > 0 {
+		slog.Info("draining", "delay", drainDelay.String())
+		for _, srv := range servers {
+			srv.SetKeepAlivesEnabled(false)
+		}
+		time.Sleep(*drainDelay)
+	}
+
+	slog.Info("shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	if err := shutdown(ctx, servers); err != nil {
+		fatal("shutdown", "err", err)
+	}
+	slog.Info("stopped")
+}
+
+// serve runs a blocking listen function in the background after logging msg
+// and args, exiting the process if it fails for any reason other than a
+// shutdown.
+func serve(listen func() error, msg string, args ...any) {
+	go func() {
+		slog.Info(msg, args...)
+		if err := listen(); !errors.Is(err, http.ErrServerClosed) {
+			fatal(msg, append(args, "err", err)...)
+		}
+	}()
+}
 
-	log.Printf("Serving %s on HTTP port: %s\n", directory, *port)
-	log.Fatal(http.ListenAndServe(":"+*port, nil))
+// shutdown gracefully stops all servers in parallel, sharing ctx's deadline.
+func shutdown(ctx context.Context, servers []*http.Server) error {
+	errs := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func() { errs <- srv.Shutdown(ctx) }()
+	}
+	var err error
+	for range servers {
+		err = errors.Join(err, <-errs)
+	}
+	return err
 }
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// testConfig returns the configuration main would build with no flags,
+// serving a temporary directory holding files (name to contents) and
+// sending the access log to io.Discard.
+func testConfig(t *testing.T, files map[string]string) Config {
+	t.Helper()
+	dir := t.TempDir()
+	for name, body := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return Config{
+		Dir:             dir,
+		Index:           "index.html",
+		ETag:            true,
+		LogFormat:       "text",
+		LogTemplate:     defaultLogTemplate,
+		AccessLog:       io.Discard,
+		Healthz:         true,
+		SecurityHeaders: defaultSecurityHeaders,
+		ServerHeader:    "resume-server/" + version,
+		Timeouts:        defaultTimeouts,
+	}
+}
+
+// testHandler builds the server for cfg and returns its handler.
+func testHandler(t *testing.T, cfg Config) http.Handler {
+	t.Helper()
+	srv, err := newServer(cfg)
+	if err != nil {
+		t.Fatalf("newServer: %v", err)
+	}
+	return srv.Handler
+}
+
+// get sends a GET for target through h, with optional header pairs.
+func get(h http.Handler, target string, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestHealthz(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"index.html": "hi"})
+	var draining atomic.Bool
+	cfg.Draining = &draining
+	h := testHandler(t, cfg)
+
+	w := get(h, "/healthz")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["status"] != "ok" {
+		t.Errorf("body = %q, want status ok", w.Body)
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("Cache-Control = %q, want no-store", cc)
+	}
+
+	draining.Store(true)
+	if w := get(h, "/healthz"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("draining: status = %d, want 503", w.Code)
+	}
+	draining.Store(false)
+
+	if err := os.RemoveAll(cfg.Dir); err != nil {
+		t.Fatal(err)
+	}
+	if w := get(h, "/healthz"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("directory gone: status = %d, want 503", w.Code)
+	}
+}
+
+func TestHealthzDisabled(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"index.html": "hi"})
+	cfg.Healthz = false
+	if w := get(testHandler(t, cfg), "/healthz"); w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", w.Code)
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	cfg := testConfig(t, map[string]string{"index.html": "hi"})
+	w := get(testHandler(t, cfg), "/missing.html")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", w.Code)
+	}
+
+	page := filepath.Join(t.TempDir(), "404.html")
+	if err := os.WriteFile(page, []byte("<h1>gone</h1>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg.NotFound = page
+	h := testHandler(t, cfg)
+
+	w = get(h, "/missing.html")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", w.Code)
+	}
+	if w.Body.String() != "<h1>gone</h1>" {
+		t.Errorf("body = %q, want the custom page", w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q, want text/html", ct)
+	}
+
+	if w := get(h, "/"); w.Code != http.StatusOK || w.Body.String() != "hi" {
+		t.Errorf("GET / = %d %q, want 200 hi", w.Code, w.Body)
+	}
+}
+
+func TestNotFoundPageUnreadable(t *testing.T) {
+	cfg := testConfig(t, nil)
+	cfg.NotFound = filepath.Join(t.TempDir(), "absent.html")
+	if _, err := newServer(cfg); err == nil {
+		t.Error("newServer accepted a missing -not-found page")
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	files := map[string]string{"a.txt": "hello"}
+
+	t.Run("text", func(t *testing.T) {
+		var out bytes.Buffer
+		cfg := testConfig(t, files)
+		cfg.AccessLog = &out
+		h := testHandler(t, cfg)
+		get(h, "/a.txt", "User-Agent", "tester/1")
+		get(h, "/nope")
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("got %d log lines, want 2:\n%s", len(lines), out.String())
+		}
+		for _, want := range []string{"GET /a.txt 200 5B", `"tester/1"`, "192.0.2.1"} {
+			if !strings.Contains(lines[0], want) {
+				t.Errorf("line %q lacks %q", lines[0], want)
+			}
+		}
+		if !strings.Contains(lines[1], "GET /nope 404") {
+			t.Errorf("line %q lacks the 404", lines[1])
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var out bytes.Buffer
+		cfg := testConfig(t, files)
+		cfg.AccessLog = &out
+		cfg.LogFormat = "json"
+		w := get(testHandler(t, cfg), "/a.txt", "User-Agent", "bad\tagent")
+
+		var e accessLogEntry
+		if err := json.Unmarshal(out.Bytes(), &e); err != nil {
+			t.Fatalf("log line %q: %v", out.String(), err)
+		}
+		if e.Method != "GET" || e.Path != "/a.txt" || e.Status != 200 || e.Bytes != 5 {
+			t.Errorf("entry = %+v", e)
+		}
+		if e.ClientIP != "192.0.2.1" {
+			t.Errorf("client_ip = %q, want 192.0.2.1", e.ClientIP)
+		}
+		if e.UserAgent != `bad\x09agent` {
+			t.Errorf("user_agent = %q, want the tab escaped", e.UserAgent)
+		}
+		if e.RequestID == "" || e.RequestID != w.Header().Get("X-Request-ID") {
+			t.Errorf("request_id = %q, response header %q", e.RequestID, w.Header().Get("X-Request-ID"))
+		}
+	})
+
+	t.Run("healthz skipped", func(t *testing.T) {
+		var out bytes.Buffer
+		cfg := testConfig(t, files)
+		cfg.AccessLog = &out
+		get(testHandler(t, cfg), "/healthz")
+		if out.Len() != 0 {
+			t.Errorf("healthz was logged: %q", out.String())
+		}
+	})
+}
+
+func TestValidate(t *testing.T) {
+	tmp := t.TempDir()
+	regular := filepath.Join(tmp, "regular")
+	if err := os.WriteFile(regular, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(tmp, "stale.sock")
+	if ln, err := net.Listen("unix", socket); err == nil {
+		ln.(*net.UnixListener).SetUnlinkOnClose(false)
+		ln.Close()
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(*Config)
+		wantErr string // "" means valid
+	}{
+		{"defaults", func(*Config) {}, ""},
+		{"new access log", func(c *Config) { c.AccessLogFile = filepath.Join(tmp, "access.log") }, ""},
+		{"existing access log", func(c *Config) { c.AccessLogFile = regular }, ""},
+		{"tcp listen", func(c *Config) { c.Listen = "127.0.0.1:0" }, ""},
+		{"unix listen", func(c *Config) { c.Listen = unixPrefix + filepath.Join(tmp, "s.sock") }, ""},
+		{"stale socket", func(c *Config) { c.Listen = unixPrefix + socket }, ""},
+		{"ip filter on tcp", func(c *Config) { c.DenyCIDRs = prefixes(t, "192.0.2.0/24") }, ""},
+		{"ip filter on unix behind a proxy", func(c *Config) {
+			c.Listen = unixPrefix + filepath.Join(tmp, "s.sock")
+			c.AllowCIDRs = prefixes(t, "192.0.2.0/24")
+			c.TrustProxy = true
+		}, ""},
+
+		{"log format", func(c *Config) { c.LogFormat = "xml" }, `unknown -log-format "xml"`},
+		{"log template", func(c *Config) { c.LogTemplate = "{{.Nope" }, "bad -log-template"},
+		{"basic auth", func(c *Config) { c.BasicAuth = "nopass" }, "-basic-auth must be in the form user:pass"},
+		{"missing dir", func(c *Config) { c.Dir = filepath.Join(tmp, "absent") }, "cannot serve"},
+		{"dir is a file", func(c *Config) { c.Dir = regular }, "not a directory"},
+		{"live reload embedded", func(c *Config) {
+			c.Embedded = fstest.MapFS{"index.html": {Data: []byte("hi")}}
+			c.LiveReload = true
+		}, "-live-reload needs an on-disk directory"},
+		{"duplicate mount", func(c *Config) {
+			c.Mounts.Set("/a=" + tmp)
+			c.Mounts.Set("/a/=" + tmp)
+		}, "/a/ is mounted more than once"},
+		{"missing 404 page", func(c *Config) { c.NotFound = filepath.Join(tmp, "absent.html") }, "cannot read 404 page"},
+		{"access log directory missing", func(c *Config) { c.AccessLogFile = "/nonexistent/x.log" }, "cannot write -access-log"},
+		{"access log is a directory", func(c *Config) { c.AccessLogFile = tmp }, "is a directory"},
+		{"socket directory missing", func(c *Config) { c.Listen = "unix:/nonexistent/s.sock" }, "socket directory /nonexistent does not exist"},
+		{"socket path taken", func(c *Config) { c.Listen = unixPrefix + regular }, "exists and is not a socket"},
+		{"deny list on unix", func(c *Config) {
+			c.Listen = unixPrefix + filepath.Join(tmp, "s.sock")
+			c.DenyCIDRs = prefixes(t, "192.0.2.0/24")
+		}, "need -trust-proxy on a unix: listener"},
+		{"allow list on unix", func(c *Config) {
+			c.Listen = unixPrefix + filepath.Join(tmp, "s.sock")
+			c.AllowCIDRs = prefixes(t, "192.0.2.0/24")
+		}, "need -trust-proxy on a unix: listener"},
+		{"negative rate limit", func(c *Config) { c.RateLimit = -1 }, "-rate-limit must not be negative"},
+		{"zero burst", func(c *Config) { c.RateLimit, c.RateBurst = 1, 0 }, "-rate-burst must be at least 1"},
+		{"negative max connections", func(c *Config) { c.MaxConns = -1 }, "-max-connections must not be negative"},
+		{"stats window", func(c *Config) { c.StatsInterval, c.StatsWindow = time.Minute, time.Second }, "-log-stats-window must be at least"},
+		{"negative duration", func(c *Config) { c.Timeouts.Write = -time.Second }, "-write-timeout must not be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t, map[string]string{"index.html": "hi"})
+			tt.modify(&cfg)
+			errs := cfg.validate()
+			if tt.wantErr == "" {
+				for _, err := range errs {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if len(errs) != 1 || !strings.Contains(errs[0].Error(), tt.wantErr) {
+				t.Errorf("errors = %v, want one containing %q", errs, tt.wantErr)
+			}
+		})
+	}
+
+	if entries, _ := filepath.Glob(filepath.Join(tmp, ".access-log-check-*")); len(entries) > 0 {
+		t.Errorf("validate left %v behind", entries)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "access.log")); !os.IsNotExist(err) {
+		t.Error("validate created the access log")
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := testConfig(t, nil)
+	cfg.LogFormat = "xml"
+	cfg.RateLimit = -1
+	cfg.AccessLogFile = "/nonexistent/x.log"
+	if errs := cfg.validate(); len(errs) != 3 {
+		t.Errorf("got %d errors, want 3: %v", len(errs), errs)
+	}
+}
+
+// TestCheckConfig runs the test binary as the server with -check-config.
+func TestCheckConfig(t *testing.T) {
+	if args := os.Getenv("RESUME_TEST_MAIN_ARGS"); args != "" {
+		os.Args = append([]string{"resume-server"}, strings.Split(args, "\n")...)
+		main()
+		os.Exit(0)
+	}
+
+	dir := testConfig(t, map[string]string{"index.html": "hi"}).Dir
+	tests := []struct {
+		name   string
+		args   []string
+		ok     bool
+		output string
+	}{
+		{"valid", []string{"-d", dir}, true, "configuration ok"},
+		{"bad access log", []string{"-d", dir, "-access-log", "/nonexistent/x.log"}, false, "cannot write -access-log"},
+		{"bad socket", []string{"-d", dir, "-listen", "unix:/nonexistent/s.sock"}, false, "socket directory"},
+		{"duplicate mount", []string{"-d", dir, "-mount", "/a=" + dir, "-mount", "/a/=" + dir}, false, "mounted more than once"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], "-test.run=^TestCheckConfig$")
+			cmd.Env = append(os.Environ(), "RESUME_TEST_MAIN_ARGS="+strings.Join(append(tt.args, "-check-config"), "\n"))
+			out, err := cmd.CombinedOutput()
+			if ok := err == nil; ok != tt.ok {
+				t.Errorf("succeeded = %v, want %v (err %v)", ok, tt.ok, err)
+			}
+			if !strings.Contains(string(out), tt.output) {
+				t.Errorf("output lacks %q:\n%s", tt.output, out)
+			}
+			if tt.ok && strings.Contains(string(out), "level=ERROR") {
+				t.Errorf("valid config logged errors:\n%s", out)
+			}
+		})
+	}
+}
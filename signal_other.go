@@ -0,0 +1,6 @@
+//go:build !unix
+
+package main
+
+// onDumpSignal does nothing: there is no SIGUSR1 on this platform.
+func onDumpSignal(dump func()) {}
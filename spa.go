@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"path"
+)
+
+// spaMiddleware serves the root index.html for paths that don't exist in
+// root, so client-side routes like /projects/foo can be deep-linked. Missing
+// paths with a file extension still fall through to a 404, keeping broken
+// asset references visible.
+func spaMiddleware(root http.FileSystem) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name := path.Clean("/" + r.URL.Path)
+			if path.Ext(name) == "" && !exists(root, name) {
+				r = withPath(r, "/")
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// exists reports whether name can be opened in root. Errors other than
+// not-exist are treated as existing so the file server reports them.
+func exists(root http.FileSystem, name string) bool {
+	f, err := root.Open(name)
+	if err != nil {
+		return !errors.Is(err, fs.ErrNotExist)
+	}
+	f.Close()
+	return true
+}
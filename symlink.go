@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// confinedDir is an http.Dir that refuses to open anything whose real path,
+// after resolving symlinks, lies outside the directory itself. Links between
+// files inside the tree keep working; http.FileServer answers 403 for the
+// ones that escape.
+type confinedDir string
+
+func (d confinedDir) Open(name string) (http.File, error) {
+	f, err := http.Dir(d).Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.check(name); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func (d confinedDir) check(name string) error {
+	dir := string(d)
+	if dir == "" {
+		dir = "."
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	real, err := filepath.EvalSymlinks(filepath.Join(dir, filepath.FromSlash(path.Clean("/"+name))))
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(root, real)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return nil
+}
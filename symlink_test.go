@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSymlinks(t *testing.T) {
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	if err := os.WriteFile(outside, []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := testConfig(t, map[string]string{"real.txt": "real", "sub/x.txt": "x"})
+	links := map[string]string{
+		"inside.txt":   filepath.Join(cfg.Dir, "real.txt"),
+		"relative.txt": "real.txt",
+		"subdir":       filepath.Join(cfg.Dir, "sub"),
+		"escape.txt":   outside,
+		"escapedir":    filepath.Dir(outside),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(cfg.Dir, name)); err != nil {
+			t.Skipf("symlinks unavailable: %v", err)
+		}
+	}
+
+	tests := []struct {
+		path   string
+		follow bool
+		want   int
+		body   string
+	}{
+		{"/inside.txt", false, http.StatusOK, "real"},
+		{"/relative.txt", false, http.StatusOK, "real"},
+		{"/subdir/x.txt", false, http.StatusOK, "x"},
+		{"/escape.txt", false, http.StatusForbidden, ""},
+		{"/escapedir/secret.txt", false, http.StatusForbidden, ""},
+		{"/escape.txt", true, http.StatusOK, "secret"},
+		{"/inside.txt", true, http.StatusOK, "real"},
+	}
+	for _, tt := range tests {
+		cfg := cfg
+		cfg.FollowSymlinks = tt.follow
+		w := get(testHandler(t, cfg), tt.path)
+		if w.Code != tt.want {
+			t.Errorf("GET %s (follow %v) = %d, want %d", tt.path, tt.follow, w.Code, tt.want)
+			continue
+		}
+		if tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("GET %s (follow %v) body = %q, want %q", tt.path, tt.follow, w.Body, tt.body)
+		}
+	}
+}
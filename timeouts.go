@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// serverTimeouts bound how long a client may hold a connection, so a slow
+// or idle client can't tie one up indefinitely.
+//
+// WriteTimeout covers the whole response, from the end of the request
+// headers to the last byte written. It must be long enough for the
+// slowest expected client to download the largest file served, or big
+// PDFs get cut off mid-transfer; hence a default far above the others.
+//
+// NoKeepAlive closes every connection after one response, for operators who
+// would rather not have clients hold connections between requests at all.
+type serverTimeouts struct {
+	ReadHeader  time.Duration
+	Read        time.Duration
+	Write       time.Duration
+	Idle        time.Duration
+	NoKeepAlive bool
+}
+
+var defaultTimeouts = serverTimeouts{
+	ReadHeader: 10 * time.Second,
+	Read:       30 * time.Second,
+	Write:      10 * time.Minute,
+	Idle:       2 * time.Minute,
+}
+
+// apply sets the timeouts on srv.
+func (t serverTimeouts) apply(srv *http.Server) {
+	srv.ReadHeaderTimeout = t.ReadHeader
+	srv.ReadTimeout = t.Read
+	srv.WriteTimeout = t.Write
+	srv.IdleTimeout = t.Idle
+	srv.SetKeepAlivesEnabled(!t.NoKeepAlive)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// traversalMiddleware answers 400 to requests whose path climbs above the
+// root with "..", including when the dots are percent-encoded once more than
+// the URL decoding undoes. ServeMux and http.FileServer already clean paths,
+// so this is a second line of defence that doesn't depend on them.
+func traversalMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if escapesRoot(r.URL.Path) {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// escapesRoot reports whether the decoded URL path p leaves the root when
+// its segments are resolved. Backslashes count as separators, as they do for
+// files on Windows.
+func escapesRoot(p string) bool {
+	// Undo up to two further levels of encoding, e.g. %252e%252e.
+	for range 2 {
+		unescaped, err := url.PathUnescape(p)
+		if err != nil || unescaped == p {
+			break
+		}
+		p = unescaped
+	}
+	depth := 0
+	for _, seg := range strings.FieldsFunc(p, func(r rune) bool { return r == '/' || r == '\\' }) {
+		switch seg {
+		case ".":
+		case "..":
+			if depth--; depth < 0 {
+				return true
+			}
+		default:
+			depth++
+		}
+	}
+	return false
+}
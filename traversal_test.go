@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEscapesRoot(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/", false},
+		{"/index.html", false},
+		{"/a/b/../c", false},
+		{"/a/..", false},
+		{"/./a/./b", false},
+		{"/..", true},
+		{"/../etc/passwd", true},
+		{"/a/../../etc/passwd", true},
+		{"/a/./../..", true},
+		{`/..\windows`, true},
+		{`/a\..\..\x`, true},
+		{"/%2e%2e/etc/passwd", true},
+		{"/%2E%2E/etc/passwd", true},
+		{"/.%2e/x", true},
+		{"/a%2f..%2f..%2fx", true},
+		{"/%252e%252e/x", true},
+		// Only two further levels are undone.
+		{"/%25252e%25252e/x", false},
+		{"/a/%2e%2e", false},
+		{"/..foo", false},
+		{"/foo..", false},
+		{"/%zz/x", false},
+	}
+	for _, tt := range tests {
+		if got := escapesRoot(tt.path); got != tt.want {
+			t.Errorf("escapesRoot(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestTraversalMiddleware(t *testing.T) {
+	h := traversalMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{"/", http.StatusOK},
+		{"/docs/resume.pdf", http.StatusOK},
+		{"/a/../b", http.StatusOK},
+		{"/../etc/passwd", http.StatusBadRequest},
+		{"/%2e%2e/etc/passwd", http.StatusBadRequest},
+		{"/%2e%2e%2fetc%2fpasswd", http.StatusBadRequest},
+		{"/%252e%252e/etc/passwd", http.StatusBadRequest},
+		{"/%25252e%25252e%25252fetc", http.StatusBadRequest},
+		{"/..%5c..%5cwindows", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("GET %s = %d, want %d", tt.target, w.Code, tt.want)
+		}
+	}
+}
+
+func TestTraversalThroughServer(t *testing.T) {
+	h := testHandler(t, testConfig(t, map[string]string{"index.html": "hi"}))
+	for _, target := range []string{"/%2e%2e/%2e%2e/etc/passwd", "/%252e%252e/etc/passwd"} {
+		if w := get(h, target); w.Code != http.StatusBadRequest {
+			t.Errorf("GET %s = %d, want 400", target, w.Code)
+		}
+	}
+}